@@ -0,0 +1,85 @@
+package main
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// writeAliases creates pages on each alias of a domain with written
+// pages, redirecting browsers to the same path on the domain, and a
+// _redirects file doing the same for hosts such as Netlify that read
+// it. The pages carry no go-import meta tags, so that the go command
+// only accepts the domain's own import paths.
+func writeAliases(written map[string]bool) error {
+	aliases := make([]string, 0, len(config.Aliases))
+	for alias := range config.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	scheme := "https"
+	if insecureFlag {
+		scheme = "http"
+	}
+	for _, alias := range aliases {
+		domain := config.Aliases[alias]
+		rests := []string{""}
+		for importPath := range written {
+			if rest, ok := strings.CutPrefix(importPath, domain+"/"); ok {
+				rests = append(rests, rest)
+			}
+		}
+		if len(rests) == 1 && !written[domain] {
+			continue
+		}
+		sort.Strings(rests)
+
+		for _, rest := range rests {
+			data := struct {
+				Target string
+				Lang   string
+				Msg    messages
+			}{
+				Target: scheme + "://" + strings.TrimSuffix(domain+"/"+rest, "/"),
+				Lang:   langFlag,
+				Msg:    lookupMessages(langFlag),
+			}
+			name := strings.TrimSuffix(alias+"/"+rest, "/") + "/index.html"
+			if err := execute(name, aliasTpl, data); err != nil {
+				return err
+			}
+		}
+
+		data := struct {
+			Target string
+		}{
+			Target: scheme + "://" + domain,
+		}
+		if err := execute(alias+"/_redirects", aliasRedirectsTpl, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aliasTpl redirects browsers from an alias to its domain.
+var aliasTpl = template.Must(template.New("alias").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<link rel="canonical" href="{{ .Target }}">
+<meta http-equiv="refresh" content="0; url={{ .Target }}">
+<title>{{ .Target }}</title>
+</head>
+<body>
+<p>{{ .Msg.Moved }} <a href="{{ .Target }}">{{ .Target }}</a>.</p>
+</body>
+</html>
+`))
+
+// aliasRedirectsTpl permanently redirects every path on an alias.
+var aliasRedirectsTpl = texttemplate.Must(texttemplate.New("redirects").Parse(`/* {{ .Target }}/:splat 301!
+`))
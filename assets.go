@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// assetsDir is the directory beneath the root of each domain holding
+// the files copied by -assets.
+const assetsDir = "assets"
+
+// assets holds the files read by -assets, by their slash-separated
+// names within the directory.
+var assets map[string][]byte
+
+// assetNames maps the name of each asset to the name it is served
+// under, which with -fingerprint includes a hash of its content.
+var assetNames map[string]string
+
+// loadAssets reads the files beneath dir into assets.
+func loadAssets(dir string) error {
+	assets = make(map[string][]byte)
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		assets[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	assetNames = make(map[string]string)
+	for name := range assets {
+		assetNames[name] = name
+	}
+	if fingerprintFlag {
+		fingerprintAssets()
+	}
+	return nil
+}
+
+// fingerprintAssets serves each asset under a name including a hash
+// of its content, so that it may be cached forever. Stylesheets are
+// hashed last, once their references to other assets are rewritten.
+func fingerprintAssets() {
+	var styles []string
+	for name := range assets {
+		if path.Ext(name) == ".css" {
+			styles = append(styles, name)
+			continue
+		}
+		assetNames[name] = fingerprint(name, assets[name])
+	}
+
+	// Longer names are replaced first, so that a name that is a
+	// suffix of another is not replaced within it.
+	var refs []string
+	for name := range assets {
+		if path.Ext(name) != ".css" {
+			refs = append(refs, name)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return len(refs[i]) > len(refs[j])
+	})
+	var oldnew []string
+	for _, name := range refs {
+		oldnew = append(oldnew, "/"+assetsDir+"/"+name, "/"+assetsDir+"/"+assetNames[name])
+	}
+	r := strings.NewReplacer(oldnew...)
+
+	for _, name := range styles {
+		assets[name] = []byte(r.Replace(string(assets[name])))
+		assetNames[name] = fingerprint(name, assets[name])
+	}
+}
+
+// fingerprint returns name with the start of the SHA-256 sum of b
+// inserted before its extension.
+func fingerprint(name string, b []byte) string {
+	sum := sha256.Sum256(b)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+// assetURL returns the URL, relative to the root of the domain, at
+// which the asset name is served. It is available to templates as
+// "asset":
+//
+//	<link rel="stylesheet" href="{{ asset "style.css" }}">
+func assetURL(name string) (string, error) {
+	served, ok := assetNames[name]
+	if !ok {
+		return "", fmt.Errorf("no asset %q in -assets", name)
+	}
+	return "/" + assetsDir + "/" + served, nil
+}
+
+// localAsset returns the content of the asset served at url, as
+// returned by assetURL, if there is one.
+func localAsset(url string) ([]byte, bool) {
+	served, ok := strings.CutPrefix(url, "/"+assetsDir+"/")
+	if !ok {
+		return nil, false
+	}
+	for name, s := range assetNames {
+		if s == served {
+			return assets[name], true
+		}
+	}
+	return nil, false
+}
+
+// writeAssets copies the assets beneath the root of each domain with
+// written pages.
+func writeAssets(written map[string]bool) error {
+	names := make([]string, 0, len(assets))
+	for name := range assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, domain := range domains(written) {
+		for _, name := range names {
+			if err := writeFile(domain+"/"+assetsDir+"/"+assetNames[name], assets[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
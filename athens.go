@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// writeAthens creates a download mode file for the Athens module proxy
+// at name in the output directory. Athens fetches the modules on the
+// vanity domains itself, and sends the go command elsewhere for any
+// other module, so that the proxy and the domains agree about which
+// paths exist.
+func writeAthens(name string, entries []indexEntry) error {
+	// Modules are matched by the prefix in their go-import meta
+	// tag, and anything beneath it, which covers nested modules.
+	seen := make(map[string]bool)
+	var paths []string
+	for _, e := range entries {
+		f := strings.Fields(e.VCS.GoImport())
+		if len(f) != 3 || seen[f[0]] {
+			continue
+		}
+		seen[f[0]] = true
+		paths = append(paths, f[0], f[0]+"/*")
+	}
+	sort.Strings(paths)
+
+	data := struct {
+		Paths []string
+	}{
+		Paths: paths,
+	}
+	return execute(name, athensTpl, data)
+}
+
+// athensTpl is HCL, so strings are quoted as Go would quote them,
+// which HCL accepts for the characters allowed in import paths.
+var athensTpl = texttemplate.Must(texttemplate.New("athens").Parse(`# Download modes for the paths on the vanity domains.
+downloadURL = "https://proxy.golang.org"
+mode = "redirect"
+{{ range .Paths }}
+download {{ printf "%q" . }} {
+    mode = "sync"
+}
+{{ end -}}
+`))
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// auditMain implements the audit command, which checks that the
+// repository of each import path exists and can be reached, as go get
+// would otherwise fail with a confusing error from the VCS.
+//
+// With -private, it also checks that each module would be kept from
+// the public checksum database, whose lookups would reveal its name.
+func auditMain(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	fs.Usage = usage
+	addFlags(fs)
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for each repository to respond")
+	fs.Parse(args)
+
+	// Pages are generated only to resolve each repository, and are
+	// discarded.
+	dest = make(memDestination)
+	g := generate(fs.Args())
+
+	// Repositories are checked once, however many paths they serve.
+	results := make(map[string]error)
+	private := make(map[string]bool)
+	var problems int
+	for _, e := range g.entries {
+		f := strings.Fields(e.VCS.GoImport())
+		if len(f) != 3 {
+			continue
+		}
+		prefix, vcs, url := f[0], f[1], f[2]
+
+		err, ok := results[url]
+		if !ok {
+			err = checkRepository(vcs, url, *timeout)
+			results[url] = err
+		}
+		if err != nil {
+			fmt.Print(redact(fmt.Sprintf("%s: %s: %v\n", e.ImportPath, url, err)))
+			problems++
+		}
+
+		if privateFlag && !private[prefix] {
+			private[prefix] = true
+			for _, problem := range checkPrivate(prefix, *timeout) {
+				fmt.Print(redact(fmt.Sprintf("%s: %s\n", prefix, problem)))
+				problems++
+			}
+		}
+	}
+
+	if summaryFlag {
+		stats.print(os.Stderr)
+	}
+	if problems > 0 {
+		os.Exit(exitFindings)
+	}
+}
+
+// checkPrivate returns the problems that would reveal the private
+// module at modulePath to the public checksum database: that it is not
+// excluded by GONOSUMDB or GOPRIVATE, and that the public proxy, which
+// feeds the database's index, already knows of it.
+func checkPrivate(modulePath string, timeout time.Duration) []string {
+	var problems []string
+
+	patterns := os.Getenv("GONOSUMDB")
+	if patterns == "" {
+		patterns = os.Getenv("GOPRIVATE")
+	}
+	if !matchPrefixPatterns(patterns, modulePath) {
+		problems = append(problems, "not matched by GONOSUMDB or GOPRIVATE, so go get would look it up in sum.golang.org")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://proxy.golang.org/"+escapeModulePath(modulePath)+"/@v/list", nil)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return append(problems, fmt.Sprintf("probing proxy.golang.org: %v", err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		problems = append(problems, "already known to proxy.golang.org")
+	}
+	return problems
+}
+
+// escapeModulePath escapes modulePath for use in module proxy URLs, by
+// replacing each upper-case letter with "!" and its lower-case form.
+func escapeModulePath(modulePath string) string {
+	var b strings.Builder
+	for _, r := range modulePath {
+		if 'A' <= r && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// matchPrefixPatterns reports whether any of the comma-separated glob
+// patterns matches a prefix of target, as the go command matches
+// GOPRIVATE and related variables.
+func matchPrefixPatterns(patterns, target string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+
+		// Match the pattern against as many leading elements of
+		// target as it has itself.
+		n := strings.Count(pattern, "/") + 1
+		prefix := target
+		for i, c := 0, 0; i < len(target); i++ {
+			if target[i] == '/' {
+				if c++; c == n {
+					prefix = target[:i]
+					break
+				}
+			}
+		}
+		if ok, _ := path.Match(pattern, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRepository reports whether the repository at url, kept in vcs,
+// can be reached. Git repositories are listed with git ls-remote, as
+// go get would; others need only respond over HTTP.
+func checkRepository(vcs, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if vcs == "git" {
+		cmd := exec.CommandContext(ctx, "git", "ls-remote", "--exit-code", url, "HEAD")
+
+		// Prompting for credentials would stall the audit; a
+		// repository needing them is reported instead.
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("%v: %s", err, msg)
+			}
+			return err
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	awsProfileFlag    string
+	awsRegionFlag     string
+	awsRoleARNFlag    string
+	awsExternalIDFlag string
+)
+
+// awsCredentials are the keys with which requests to AWS are signed.
+type awsCredentials struct {
+	accessKey, secretKey, token string
+}
+
+// awsConfig is the configuration of the AWS services used, read from
+// the flags, the environment and the shared files of the AWS CLI.
+type awsConfig struct {
+	region string
+	creds  awsCredentials
+
+	// roleARN, if set, names the role assumed with creds, with
+	// the external ID required by its trust policy.
+	roleARN, externalID string
+}
+
+// loadAWSConfig returns the AWS configuration as the AWS CLI would
+// read it. Credentials come from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, unless -aws-profile
+// names a profile of the shared credentials and config files, which
+// are otherwise read for the profile in AWS_PROFILE or the default.
+// A profile may assume a role with role_arn, external_id and
+// source_profile, as -aws-role-arn and -aws-external-id do.
+func loadAWSConfig() (*awsConfig, error) {
+	home, _ := os.UserHomeDir()
+	credsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credsFile == "" {
+		credsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(home, ".aws", "config")
+	}
+	credentials, err := readINI(credsFile)
+	if err != nil {
+		return nil, err
+	}
+	config, err := readINI(configFile)
+	if err != nil {
+		return nil, err
+	}
+	// Profiles other than the default are prefixed in the config
+	// file, but not in the credentials file.
+	settings := func(profile string) (map[string]string, bool) {
+		section := "profile " + profile
+		if profile == "default" {
+			section = profile
+		}
+		s, inConfig := config[section]
+		c, inCreds := credentials[profile]
+		merged := make(map[string]string)
+		for k, v := range s {
+			merged[k] = v
+		}
+		for k, v := range c {
+			merged[k] = v
+		}
+		return merged, inConfig || inCreds
+	}
+
+	profile := awsProfileFlag
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	p, ok := settings(profile)
+	if !ok && (awsProfileFlag != "" || os.Getenv("AWS_PROFILE") != "") {
+		return nil, fmt.Errorf("no AWS profile %q in %s or %s", profile, credsFile, configFile)
+	}
+
+	cfg := &awsConfig{
+		region:     first(awsRegionFlag, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), p["region"], "us-east-1"),
+		roleARN:    first(awsRoleARNFlag, p["role_arn"]),
+		externalID: first(awsExternalIDFlag, p["external_id"]),
+	}
+	if env := os.Getenv("AWS_ACCESS_KEY_ID"); env != "" && awsProfileFlag == "" {
+		cfg.creds = awsCredentials{env, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}
+		return cfg, nil
+	}
+
+	// A profile assuming a role takes the credentials to assume it
+	// with from its source profile.
+	if source := p["source_profile"]; source != "" && p["role_arn"] != "" {
+		if p, ok = settings(source); !ok {
+			return nil, fmt.Errorf("no AWS profile %q, the source_profile of %q", source, profile)
+		}
+	}
+	cfg.creds = awsCredentials{p["aws_access_key_id"], p["aws_secret_access_key"], p["aws_session_token"]}
+	return cfg, nil
+}
+
+// first returns the first of values that is not empty.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// readINI reads the sections of the INI file name, in the format of
+// the AWS CLI's shared files. A missing file has no sections.
+func readINI(name string) (map[string]map[string]string, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sections := make(map[string]map[string]string)
+	var section map[string]string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "", line[0] == '#', line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			section = make(map[string]string)
+			sections[name] = section
+		default:
+			k, v, ok := strings.Cut(line, "=")
+			if ok && section != nil {
+				section[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return sections, nil
+}
+
+// assumeRole returns temporary credentials for the role cfg.roleARN,
+// obtained from STS with cfg.creds. The endpoint of STS may be set by
+// AWS_ENDPOINT_URL_STS.
+func assumeRole(cfg *awsConfig) (awsCredentials, error) {
+	if cfg.creds.accessKey == "" || cfg.creds.secretKey == "" {
+		return awsCredentials{}, fmt.Errorf("no credentials with which to assume role %s", cfg.roleARN)
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	if endpoint == "" {
+		endpoint = "https://sts." + cfg.region + ".amazonaws.com/"
+	}
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {cfg.roleARN},
+		"RoleSessionName": {"vanity"},
+	}
+	if cfg.externalID != "" {
+		form.Set("ExternalId", cfg.externalID)
+	}
+	body := []byte(form.Encode())
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cfg.creds.token != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.creds.token)
+	}
+	sum := sha256.Sum256(body)
+	signV4(req, "sts", cfg.region, cfg.creds.accessKey, cfg.creds.secretKey, hex.EncodeToString(sum[:]), time.Now())
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer resp.Body.Close()
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(msg, &e) != nil {
+			e.Message = string(bytes.TrimSpace(msg))
+		}
+		return awsCredentials{}, fmt.Errorf("assuming role %s: %s: %s %s", cfg.roleARN, resp.Status, e.Code, e.Message)
+	}
+	var r struct {
+		AccessKeyID     string `xml:"AssumeRoleResult>Credentials>AccessKeyId"`
+		SecretAccessKey string `xml:"AssumeRoleResult>Credentials>SecretAccessKey"`
+		SessionToken    string `xml:"AssumeRoleResult>Credentials>SessionToken"`
+	}
+	if err := xml.Unmarshal(msg, &r); err != nil {
+		return awsCredentials{}, fmt.Errorf("assuming role %s: %v", cfg.roleARN, err)
+	}
+	return awsCredentials{r.AccessKeyID, r.SecretAccessKey, r.SessionToken}, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// backends open the destination for each URL scheme accepted by -o.
+// A file added to the package can register another in its init
+// function, so that a target is supported without changes elsewhere.
+var backends = map[string]func(u *url.URL) (destination, error){
+	"file":   openFileBackend,
+	"memory": openMemoryBackend,
+	"s3":     openS3Backend,
+	"gs":     openGSBackend,
+}
+
+// openDestination returns the destination named by -o: a URL with a
+// scheme in backends, or else the path of a local directory.
+func openDestination(s string) (destination, error) {
+	if !strings.Contains(s, "://") {
+		return dirDestination(s), nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("-o: %v", err)
+	}
+	open, ok := backends[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("-o %s: unknown scheme %q", s, u.Scheme)
+	}
+	return open(u)
+}
+
+// openFileBackend returns the local directory named by a file URL.
+func openFileBackend(u *url.URL) (destination, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("-o %s: files can only be written to the local host", u)
+	}
+	if u.Path == "" {
+		return nil, fmt.Errorf("-o %s: no directory", u)
+	}
+	return dirDestination(filepath.FromSlash(u.Path)), nil
+}
+
+// openMemoryBackend returns a destination discarding the files once
+// generated, for checking them without writing anything.
+func openMemoryBackend(u *url.URL) (destination, error) {
+	return make(memDestination), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+)
+
+// Approximate metrics of the badge font, used to size the badge
+// without measuring text.
+const (
+	badgeCharWidth = 7
+	badgePadding   = 10
+)
+
+// writeBadge creates an SVG badge showing importPath at
+// badge/<importPath>.svg beneath its domain, so that it is served
+// from the domain itself.
+func writeBadge(importPath string) (err error) {
+	domain, _, _ := strings.Cut(importPath, "/")
+	w, err := create(domain + "/badge/" + importPath + ".svg")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	label, value := "go get", importPath
+	data := struct {
+		Label, Value           string
+		LabelWidth, ValueWidth int
+		Width, LabelX, ValueX  int
+	}{
+		Label:      label,
+		Value:      value,
+		LabelWidth: len(label)*badgeCharWidth + badgePadding,
+		ValueWidth: len(value)*badgeCharWidth + badgePadding,
+	}
+	data.Width = data.LabelWidth + data.ValueWidth
+	data.LabelX = data.LabelWidth / 2
+	data.ValueX = data.LabelWidth + data.ValueWidth/2
+	return badgeTpl.Execute(w, data)
+}
+
+var badgeTpl = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{ .Width }}" height="20" role="img" aria-label="{{ .Label }}: {{ .Value }}">
+<title>{{ .Label }}: {{ .Value }}</title>
+<rect width="{{ .LabelWidth }}" height="20" fill="#555"/>
+<rect x="{{ .LabelWidth }}" width="{{ .ValueWidth }}" height="20" fill="#00add8"/>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{ .LabelX }}" y="14">{{ .Label }}</text>
+<text x="{{ .ValueX }}" y="14">{{ .Value }}</text>
+</g>
+</svg>
+`))
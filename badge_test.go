@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBadgeServed(t *testing.T) {
+	mem := make(memDestination)
+	defer func(d destination) { dest = d }(dest)
+	dest = mem
+
+	if err := writeBadge("vanity.example.com/foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "https://vanity.example.com/badge/vanity.example.com/foo.svg", nil)
+	w := httptest.NewRecorder()
+	memHandler(mem).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d, want %d", r.URL, w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("GET %s: Content-Type %q, want image/svg+xml", r.URL, ct)
+	}
+	if !strings.Contains(w.Body.String(), "vanity.example.com/foo") {
+		t.Errorf("GET %s: badge does not show the import path:\n%s", r.URL, w.Body)
+	}
+}
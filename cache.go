@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Classes of generated file, each cached for a different time.
+const (
+	classPage  = "page"  // landing pages for import paths
+	classIndex = "index" // domain indexes and files describing them
+	classError = "error" // error pages
+	classAsset = "asset" // images and other static files
+
+	// classImmutable is the class of assets named by their content
+	// with -fingerprint, which never change.
+	classImmutable = "immutable"
+)
+
+// cacheControlFlag holds the Cache-Control header for each class of
+// file. Landing pages rarely change, so they may be cached for long,
+// while indexes and error pages change as paths are added.
+var cacheControlFlag = cacheControlValue{
+	classPage:      "public, max-age=86400",
+	classIndex:     "public, max-age=300",
+	classError:     "public, max-age=300",
+	classAsset:     "public, max-age=604800",
+	classImmutable: "public, max-age=31536000, immutable",
+}
+
+// indexFiles are the files at the root of a domain that describe it as
+// a whole.
+var indexFiles = []string{"index.html", "opensearch.xml", searchIndexFile, "graph.html", "graph.dot"}
+
+// fileClass returns the class of the generated file with the
+// slash-separated name, which begins with its domain.
+func fileClass(name string) string {
+	dir, base := path.Split(name)
+	atRoot := !strings.Contains(strings.TrimSuffix(dir, "/"), "/")
+	switch {
+	case atRoot && base == errorPage:
+		return classError
+	case atRoot && contains(indexFiles, base):
+		return classIndex
+	case base == "index.html", base == goGetPage, path.Ext(base) == ".html":
+		return classPage
+	case fingerprintFlag && strings.Contains(dir, "/"+assetsDir+"/"):
+		return classImmutable
+	}
+	return classAsset
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheRules returns the _headers rules setting Cache-Control for the
+// files on domain, given the import paths written. Hosts combine the
+// values of rules matching the same path, so no two rules overlap.
+func cacheRules(domain string, written map[string]bool) []headerRule {
+	header := func(class string) [][2]string {
+		return [][2]string{{"Cache-Control", cacheControlFlag[class]}}
+	}
+
+	root := classIndex
+	if written[domain] {
+		root = classPage
+	}
+	rules := []headerRule{
+		{Path: "/", Headers: header(root)},
+		{Path: "/" + errorPage, Headers: header(classError)},
+	}
+	for _, name := range indexFiles {
+		class := classIndex
+		if name == "index.html" {
+			class = root
+		}
+		rules = append(rules, headerRule{Path: "/" + name, Headers: header(class)})
+	}
+	for _, name := range iconFiles {
+		rules = append(rules, headerRule{Path: "/" + name, Headers: header(classAsset)})
+	}
+	if assetsFlag != "" {
+		class := classAsset
+		if fingerprintFlag {
+			class = classImmutable
+		}
+		rules = append(rules, headerRule{Path: "/" + assetsDir + "/*", Headers: header(class)})
+	}
+
+	var paths []string
+	for importPath := range written {
+		if rest, ok := strings.CutPrefix(importPath, domain+"/"); ok {
+			paths = append(paths, rest)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		rules = append(rules,
+			headerRule{Path: "/" + p, Headers: header(classPage)},
+			headerRule{Path: "/" + p + "/", Headers: header(classPage)})
+	}
+	return rules
+}
+
+// cacheControlValue is a flag that sets the Cache-Control header for
+// a class of file, as class=value.
+type cacheControlValue map[string]string
+
+func (v cacheControlValue) Set(str string) error {
+	class, value, ok := strings.Cut(str, "=")
+	if _, known := v[class]; !ok || !known {
+		return fmt.Errorf("invalid %q: expected class=value for a class of page, index, error, asset or immutable", str)
+	}
+	v[class] = value
+	return nil
+}
+
+func (v cacheControlValue) String() string {
+	var classes []string
+	for class, value := range v {
+		classes = append(classes, class+"="+value)
+	}
+	sort.Strings(classes)
+	return strings.Join(classes, "; ")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// writeCleanURLs creates a list at name in the output directory of the
+// copies a host without directory indexes needs: each line names a
+// page and the extensionless object that should hold a copy of it.
+//
+// The copies cannot be written beside the pages themselves, as the
+// object for a path shares its name with the directory of the page
+// for the path, and of any path beneath it.
+func writeCleanURLs(name string, written map[string]bool) (err error) {
+	var paths []string
+	for importPath := range written {
+		// A domain's root is served by the host's index document.
+		if strings.Contains(importPath, "/") {
+			paths = append(paths, importPath)
+		}
+	}
+	sort.Strings(paths)
+
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for _, p := range paths {
+		if _, err := fmt.Fprintf(w, "%s %s\n", path.Join(p, "index.html"), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Protocols by which git repositories may be cloned, as configured for
+// a path or a host.
+const (
+	protocolHTTPS = "https"
+	protocolSSH   = "ssh"
+)
+
+// protocol returns the protocol configured for cloning the repository
+// r, by the settings for its path or else its host, or an empty string
+// if none is.
+func protocol(r Repo) string {
+	if p := config.Lookup(r.ImportPath).Protocol; p != "" {
+		return p
+	}
+	host, _, _ := strings.Cut(r.Repository, "/")
+	return config.Hosts[host].Protocol
+}
+
+// sshProvider advertises the git repositories of a Provider over SSH
+// rather than HTTPS, for organizations that refuse anonymous clones.
+type sshProvider struct {
+	Provider
+}
+
+func (p sshProvider) GoImport() string {
+	f := strings.Fields(p.Provider.GoImport())
+	if len(f) >= 3 && f[1] == "git" {
+		if rest, ok := strings.CutPrefix(f[2], "https://"); ok {
+			f[2] = "ssh://git@" + rest
+		}
+	}
+	return strings.Join(f, " ")
+}
+
+func (p sshProvider) unwrap() Provider { return p.Provider }
+
+// cloneHelp tells git users how to clone a repository by the other
+// protocol to the one advertised.
+type cloneHelp struct {
+	// Protocol is the protocol that git may use instead.
+	Protocol string
+
+	// Command configures git to use it.
+	Command string
+}
+
+// newCloneHelp returns the help for cloning the repository in the
+// go-import meta tag content goImport by another protocol, if the
+// protocol of the repository r is configured.
+func newCloneHelp(r Repo, goImport string) *cloneHelp {
+	if protocol(r) == "" {
+		return nil
+	}
+	f := strings.Fields(goImport)
+	if len(f) != 3 || f[1] != "git" {
+		return nil
+	}
+	u, err := url.Parse(f[2])
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	// git rewrites URLs beginning with the advertised prefix to
+	// begin with the other instead.
+	advertised := (&url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host, Path: "/"}).String()
+	h := &cloneHelp{Protocol: "SSH"}
+	other := "ssh://git@" + u.Host + "/"
+	if u.Scheme == protocolSSH {
+		h.Protocol = "HTTPS"
+		other = "https://" + u.Host + "/"
+	}
+	h.Command = fmt.Sprintf("git config --global url.%q.insteadOf %q", other, advertised)
+	return h
+}
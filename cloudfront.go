@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// cloudFrontPolicy is the configuration of a CloudFront response headers
+// policy, as accepted by "aws cloudfront create-response-headers-policy
+// --response-headers-policy-config".
+type cloudFrontPolicy struct {
+	Name                  string
+	Comment               string
+	SecurityHeadersConfig struct {
+		StrictTransportSecurity struct {
+			Override               bool
+			IncludeSubdomains      bool
+			AccessControlMaxAgeSec int
+		}
+		ContentSecurityPolicy struct {
+			Override              bool
+			ContentSecurityPolicy string
+		}
+		ContentTypeOptions struct {
+			Override bool
+		}
+	}
+}
+
+// writeCloudFront creates the configuration of a CloudFront response
+// headers policy at name in the output directory, sending the same
+// security headers as -headers for each domain with written pages.
+//
+// A policy cannot set Content-Type for some files only, so each
+// page's type and charset must instead be set on the object itself, as
+// "aws s3 sync" does from its extension.
+func writeCloudFront(name string, written map[string]bool) (err error) {
+	var p cloudFrontPolicy
+	p.Name = "vanity-" + strings.NewReplacer(".", "-", ":", "-").Replace(strings.Join(domains(written), "_"))
+	if len(p.Name) > 128 {
+		p.Name = p.Name[:128]
+	}
+	p.Comment = "Security headers for " + strings.Join(domains(written), ", ")
+
+	s := &p.SecurityHeadersConfig
+	s.StrictTransportSecurity.Override = true
+	s.StrictTransportSecurity.IncludeSubdomains = true
+	s.StrictTransportSecurity.AccessControlMaxAgeSec = hstsMaxAge
+	s.ContentSecurityPolicy.Override = true
+	s.ContentSecurityPolicy.ContentSecurityPolicy = contentSecurityPolicy()
+	s.ContentTypeOptions.Override = true
+
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// findCaseCollisions returns each group of written import paths that
+// differ only in case. Hosts that compare paths case-insensitively
+// would serve the same page for all of them.
+func findCaseCollisions(written map[string]bool) [][]string {
+	byFold := make(map[string][]string)
+	for importPath := range written {
+		fold := strings.ToLower(importPath)
+		byFold[fold] = append(byFold[fold], importPath)
+	}
+
+	var collisions [][]string
+	for _, paths := range byFold {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			collisions = append(collisions, paths)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i][0] < collisions[j][0]
+	})
+	return collisions
+}
+
+// checkCaseCollisions fails the run, or with -force warns, if any
+// written import paths differ only in case.
+func checkCaseCollisions(written map[string]bool) {
+	collisions := findCaseCollisions(written)
+	for _, paths := range collisions {
+		logf("%s: differ only in case\n", strings.Join(paths, ", "))
+	}
+	if len(collisions) > 0 {
+		checkOrWarn(fmt.Errorf("%d sets of import paths differ only in case", len(collisions)), exitLoad)
+	}
+}
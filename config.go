@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// config holds the configuration loaded by the -config flag.
+var config Config
+
+// Config describes settings for paths on the vanity domain.
+//
+// A configuration file is a JSON document such as:
+//
+//	{
+//	  "allow": ["vanity.example.com/foo", "vanity.example.com/tools"],
+//	  "aliases": {"www.vanity.example.com": "vanity.example.com"},
+//	  "moved": {"vanity.example.com/oldfoo": "vanity.example.com/foo"},
+//	  "retired": {
+//	    "vanity.example.com/bar": {"reason": "Use vanity.example.com/foo instead.", "archive": "github.com/actual-user/bar"}
+//	  },
+//	  "paths": {
+//	    "vanity.example.com/foo": {
+//	      "display": {
+//	        "name": "Foo",
+//	        "description": "Tools for working with foo.",
+//	        "links": [
+//	          {"title": "Issues", "url": "https://github.com/actual-user/foo/issues"}
+//	        ]
+//	      },
+//	      "tags": ["tools"],
+//	      "source": {
+//	        "dir": "https://{repo}/src/{branch}{/dir}",
+//	        "file": "https://{repo}/src/{branch}{/dir}/{file}#L{line}",
+//	        "branch": "main"
+//	      }
+//	    },
+//	    "vanity.example.com/tools": {
+//	      "replace": "vanity.example.com/tools=gitlab.example.com/tools",
+//	      "mirror": "vanity.example.com/tools=github.com/actual-user/tools",
+//	      "provider": "gitlab"
+//	    },
+//	    "vanity.example.com/internal": {
+//	      "proxy": {"type": "artifactory", "url": "https://example.jfrog.io/artifactory/go-internal"}
+//	    }
+//	  },
+//	  "hosts": {
+//	    "git.example.com": {"provider": "cgit", "protocol": "ssh"},
+//	    "code.example.com": {
+//	      "templates": {
+//	        "goImport": "{{.ImportPath}} git https://{{.Repository}}.git",
+//	        "goSource": "{{.ImportPath}} _ https://{{.Repository}}/browse{/dir} https://{{.Repository}}/browse{/dir}/{file}#{line}"
+//	      }
+//	    }
+//	  }
+//	}
+type Config struct {
+	// Allow, if not empty, lists the only import paths for which
+	// pages are generated or served, along with the paths beneath
+	// them. Others are refused, so that mistyped paths are not
+	// resolved.
+	Allow []string `json:"allow"`
+
+	// Aliases maps other hosts to the vanity domain they alias, such
+	// as the targets of its CNAME records or a legacy name. Pages on
+	// an alias redirect to the vanity domain, without any go-import
+	// meta tag, and repositories there would send go get back to
+	// the vanity domain.
+	Aliases map[string]string `json:"aliases"`
+
+	// Moved maps the old import paths of renamed modules to their
+	// new ones. Each page beneath a new path is also published at
+	// the old, with a notice that it is deprecated and meta tags
+	// for the old path, until importers have moved. The paths are
+	// those of whole modules, as the go-import meta tag covers a
+	// whole module.
+	Moved map[string]string `json:"moved"`
+
+	// Retired maps the import paths of removed modules to how they
+	// were removed. Each is given a page explaining so, rather than
+	// the path failing with an error that go get reports cryptically.
+	Retired map[string]Retirement `json:"retired"`
+
+	// Paths maps import paths to their settings. Settings for a
+	// path also apply to the packages beneath it, unless a path
+	// nearer to a package sets them too.
+	Paths map[string]PathConfig `json:"paths"`
+
+	// Hosts maps the hosts of repositories to their settings.
+	Hosts map[string]HostConfig `json:"hosts"`
+}
+
+// HostConfig holds the settings for a host of repositories.
+type HostConfig struct {
+	// Provider names the software serving repositories on the
+	// host: "github", "gitlab", "cgit", "gitweb" or "launchpad".
+	Provider string `json:"provider"`
+
+	// Command, if set, is run to produce the metadata for each
+	// repository on the host instead of a known provider.
+	Command []string `json:"command"`
+
+	// Templates, if set, produce the metadata for each repository
+	// on the host instead of a known provider.
+	Templates *ProviderTemplates `json:"templates"`
+
+	// Protocol, if set, is the protocol by which the go command is
+	// told to clone git repositories: "https" or "ssh". Pages then
+	// show how to configure git to use the other.
+	Protocol string `json:"protocol"`
+}
+
+// PathConfig holds the settings for a single import path.
+type PathConfig struct {
+	Display Display `json:"display"`
+
+	// Tags categorize the path on the domain index.
+	Tags []string `json:"tags"`
+
+	// Source, if set, overrides the go-source links of the
+	// repository at the path.
+	Source *SourceTemplates `json:"source"`
+
+	// Replace, if set, is used instead of -replace for
+	// repositories beneath the path, in the same format.
+	Replace *replacerValue `json:"replace"`
+
+	// Mirror, if set, maps repositories beneath the path to a copy
+	// elsewhere, in the same format as Replace. With -mirror, the
+	// copy is advertised instead, such as while the host of the
+	// repositories is unavailable. The provider and source settings
+	// for the path describe the repositories, so are not used for
+	// their mirrors.
+	Mirror *replacerValue `json:"mirror"`
+
+	// Proxy, if set, serves modules beneath the path from a module
+	// proxy instead of their repositories.
+	Proxy *ProxyConfig `json:"proxy"`
+
+	// The provider settings, if any are set, are used instead of
+	// those for the host of repositories beneath the path. This
+	// lets parts of a domain be served from different places.
+	HostConfig
+}
+
+// SourceTemplates are URL templates for the go-source meta tag. As well
+// as the {dir}, {/dir}, {file} and {line} placeholders expanded by
+// documentation sites, {repo} is replaced by the repository and
+// {branch} by Branch.
+type SourceTemplates struct {
+	Dir    string `json:"dir"`
+	File   string `json:"file"`
+	Branch string `json:"branch"` // default "master"
+}
+
+// expand replaces the {repo} and {branch} placeholders in tpl. For a
+// module at dir within the repository, its directories are prefixed
+// by dir.
+func (s SourceTemplates) expand(tpl, repository, dir string) string {
+	branch := s.Branch
+	if branch == "" {
+		branch = "master"
+	}
+	tpl = strings.NewReplacer("{repo}", repository, "{branch}", branch).Replace(tpl)
+	if dir != "" {
+		tpl = moduleDirReplacer(dir).Replace(tpl)
+	}
+	return tpl
+}
+
+// Display customizes how a path is presented on its landing page.
+type Display struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Links       []Link `json:"links"`
+}
+
+// Link is an additional link shown on a landing page.
+type Link struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// loadConfig reads a configuration file from name.
+func loadConfig(name string) (Config, error) {
+	var c Config
+
+	f, err := os.Open(name)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, err
+	}
+
+	// Internationalized domains are given in their punycode form,
+	// as import paths must be ASCII.
+	if c.Allow, err = asciiDomains(c.Allow); err != nil {
+		return c, fmt.Errorf("%s: %v", name, err)
+	}
+	aliases := make(map[string]string, len(c.Aliases))
+	for alias, domain := range c.Aliases {
+		pair, err := asciiDomains([]string{alias, domain})
+		if err != nil {
+			return c, fmt.Errorf("%s: %v", name, err)
+		}
+		aliases[pair[0]] = pair[1]
+	}
+	c.Aliases = aliases
+	moved := make(map[string]string, len(c.Moved))
+	for old, new := range c.Moved {
+		pair, err := asciiDomains([]string{old, new})
+		if err != nil {
+			return c, fmt.Errorf("%s: %v", name, err)
+		}
+		old, new = pair[0], pair[1]
+		// A path moved beneath its new path would be moved
+		// again from there, without end.
+		if old == new || strings.HasPrefix(old, new+"/") {
+			return c, fmt.Errorf("%s: cannot move %s to %s", name, old, new)
+		}
+		moved[old] = new
+	}
+	c.Moved = moved
+	retired := make(map[string]Retirement, len(c.Retired))
+	for p, r := range c.Retired {
+		ascii, err := asciiDomain(p)
+		if err != nil {
+			return c, fmt.Errorf("%s: %v", name, err)
+		}
+		retired[ascii] = r
+	}
+	c.Retired = retired
+	hosts := make(map[string]HostConfig, len(c.Hosts))
+	for host, hc := range c.Hosts {
+		if err := hc.validate(); err != nil {
+			return c, fmt.Errorf("%s: host %s: %v", name, host, err)
+		}
+		ascii, err := asciiDomain(host)
+		if err != nil {
+			return c, fmt.Errorf("%s: %v", name, err)
+		}
+		hosts[ascii] = hc
+	}
+	c.Hosts = hosts
+	paths := make(map[string]PathConfig, len(c.Paths))
+	for p, pc := range c.Paths {
+		ascii, err := asciiDomain(p)
+		if err != nil {
+			return c, fmt.Errorf("%s: %v", name, err)
+		}
+		paths[ascii] = pc
+		if err := pc.HostConfig.validate(); err != nil {
+			return c, fmt.Errorf("%s: path %s: %v", name, p, err)
+		}
+		if pc.Proxy != nil {
+			if _, err := pc.Proxy.proxyURL(); err != nil {
+				return c, fmt.Errorf("%s: path %s: %v", name, p, err)
+			}
+		}
+	}
+	c.Paths = paths
+	return c, nil
+}
+
+// validate reports whether the provider settings are usable.
+func (hc HostConfig) validate() error {
+	if _, ok := providers[hc.Provider]; hc.Provider != "" && !ok {
+		return fmt.Errorf("%w %q", ErrUnknownProvider, hc.Provider)
+	}
+	if hc.Protocol != "" && hc.Protocol != protocolHTTPS && hc.Protocol != protocolSSH {
+		return fmt.Errorf("unknown protocol %q", hc.Protocol)
+	}
+	if len(hc.Command) > 0 && hc.Templates != nil {
+		return fmt.Errorf("only one of command and templates may be set")
+	}
+	if hc.Templates != nil {
+		if _, _, _, err := hc.Templates.parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSet reports whether any provider settings are set.
+func (hc HostConfig) isSet() bool {
+	return hc.Provider != "" || len(hc.Command) > 0 || hc.Templates != nil
+}
+
+// repository returns the repository holding the package at
+// importPath, by the mirror or replacements configured for it or else
+// -replace.
+func (c Config) repository(importPath string) string {
+	if c.mirrored(importPath) {
+		return c.Lookup(importPath).Mirror.Replace(importPath)
+	}
+	if r := c.Lookup(importPath).Replace; r != nil {
+		return r.Replace(importPath)
+	}
+	if replacerFlag.Replacer == nil {
+		return importPath
+	}
+	return replacerFlag.Replace(importPath)
+}
+
+// mirrored reports whether the mirror of the repository holding the
+// package at importPath is advertised.
+func (c Config) mirrored(importPath string) bool {
+	return mirrorFlag && c.Lookup(importPath).Mirror != nil
+}
+
+// allowed reports whether pages may be generated or served for
+// importPath.
+func (c Config) allowed(importPath string) bool {
+	if len(c.Allow) == 0 {
+		return true
+	}
+	for _, p := range c.Allow {
+		if importPath == p || strings.HasPrefix(importPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the settings for importPath, combined from the
+// configured paths that are equal to or parents of importPath. Each
+// setting is taken from the longest of them that sets it, except the
+// display name and description, which describe only the path itself.
+func (c Config) Lookup(importPath string) PathConfig {
+	var pc PathConfig
+	if exact, ok := c.Paths[importPath]; ok {
+		pc.Display.Name, pc.Display.Description = exact.Display.Name, exact.Display.Description
+	}
+	for p := importPath; ; {
+		if parent, ok := c.Paths[p]; ok {
+			pc.inherit(parent)
+		}
+
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return pc
+		}
+		p = p[:i]
+	}
+}
+
+// inherit sets the settings of pc that are not set to those of
+// parent, but for the display name and description, which a package
+// does not share with its parent. The provider settings are taken
+// together, as only one of them is used.
+func (pc *PathConfig) inherit(parent PathConfig) {
+	if pc.Display.Links == nil {
+		pc.Display.Links = parent.Display.Links
+	}
+	if pc.Tags == nil {
+		pc.Tags = parent.Tags
+	}
+	if pc.Source == nil {
+		pc.Source = parent.Source
+	}
+	if pc.Replace == nil {
+		pc.Replace = parent.Replace
+	}
+	if pc.Mirror == nil {
+		pc.Mirror = parent.Mirror
+	}
+	if pc.Proxy == nil {
+		pc.Proxy = parent.Proxy
+	}
+	if !pc.HostConfig.isSet() {
+		pc.Provider, pc.Command, pc.Templates = parent.Provider, parent.Command, parent.Templates
+	}
+	if pc.Protocol == "" {
+		pc.Protocol = parent.Protocol
+	}
+}
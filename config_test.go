@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkLookup measures finding the settings of a deeply nested
+// package among many configured paths.
+func BenchmarkLookup(b *testing.B) {
+	c := Config{Paths: make(map[string]PathConfig)}
+	for i := 0; i < 1000; i++ {
+		c.Paths[fmt.Sprintf("vanity.example.com/repo%d", i)] = PathConfig{Tags: []string{"tools"}}
+	}
+	c.Paths["vanity.example.com/repo7/cmd"] = PathConfig{Display: Display{Name: "Commands"}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Lookup("vanity.example.com/repo7/cmd/tool/internal/x")
+	}
+}
+
+func TestLookupDisplay(t *testing.T) {
+	c := Config{Paths: map[string]PathConfig{
+		"vanity.example.com/repo": {
+			Display: Display{Name: "Repo", Description: "A repository.", Links: []Link{{Title: "Chat", URL: "https://chat.example.com"}}},
+			Tags:    []string{"tools"},
+		},
+	}}
+
+	pc := c.Lookup("vanity.example.com/repo")
+	if pc.Display.Name != "Repo" || pc.Display.Description != "A repository." {
+		t.Errorf("Lookup of the configured path: display %+v, want its name and description", pc.Display)
+	}
+
+	pc = c.Lookup("vanity.example.com/repo/sub")
+	if pc.Display.Name != "" || pc.Display.Description != "" {
+		t.Errorf("Lookup of a package beneath it: inherited name %q and description %q", pc.Display.Name, pc.Display.Description)
+	}
+	if len(pc.Display.Links) != 1 || len(pc.Tags) != 1 {
+		t.Errorf("Lookup of a package beneath it: links %v and tags %v not inherited", pc.Display.Links, pc.Tags)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// ProviderTemplates holds text/template snippets producing the metadata
+// for repositories on a host. Each is executed with the ImportPath,
+// Repository, Dir and Branch of the repository, and may call the
+// functions in templateFuncs. go-source content produced for the root
+// of the repository is adjusted for a module in a subdirectory.
+type ProviderTemplates struct {
+	GoImport string `json:"goImport"`
+	GoSource string `json:"goSource"`
+	Releases string `json:"releases"`
+}
+
+// parse parses each of the templates.
+func (t ProviderTemplates) parse() (goImport, goSource, releases *template.Template, err error) {
+	if goImport, err = template.New("goImport").Funcs(templateFuncs).Parse(t.GoImport); err != nil {
+		return
+	}
+	if goSource, err = template.New("goSource").Funcs(templateFuncs).Parse(t.GoSource); err != nil {
+		return
+	}
+	releases, err = template.New("releases").Funcs(templateFuncs).Parse(t.Releases)
+	return
+}
+
+// Custom holds metadata produced for a repository by configuration,
+// rather than derived from a known provider.
+type Custom struct {
+	Repo
+
+	goImport string
+	goSource string
+	releases string
+}
+
+func (c Custom) GoImport() string { return c.goImport }
+func (c Custom) GoSource() string { return c.goSource }
+func (c Custom) Releases() string { return c.releases }
+
+// templateProvider returns a Provider whose metadata is produced by
+// executing templates.
+func templateProvider(t ProviderTemplates, r Repo) (Provider, error) {
+	c := Custom{Repo: r}
+
+	goImport, goSource, releases, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range []struct {
+		tpl *template.Template
+		out *string
+	}{
+		{goImport, &c.goImport},
+		{goSource, &c.goSource},
+		{releases, &c.releases},
+	} {
+		var buf bytes.Buffer
+		if err := x.tpl.Execute(&buf, c); err != nil {
+			return nil, err
+		}
+		*x.out = strings.TrimSpace(buf.String())
+	}
+	c.goSource = moduleSource(c.goSource, r)
+	return c, nil
+}
+
+// commandProvider returns a Provider whose metadata is produced by
+// running an external command.
+//
+// The command is given the repository in the environment variables
+// VANITY_IMPORT_PATH, VANITY_REPOSITORY, VANITY_DIR and VANITY_BRANCH,
+// and must print a JSON object with the fields "goImport", "goSource"
+// and "releases".
+func commandProvider(args []string, r Repo) (Provider, error) {
+	if restrictedFlag {
+		return nil, fmt.Errorf("%s: running %s is not allowed with -restricted", r.ImportPath, args[0])
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"VANITY_IMPORT_PATH="+r.ImportPath,
+		"VANITY_REPOSITORY="+r.Repository,
+		"VANITY_DIR="+r.Dir,
+		"VANITY_BRANCH="+r.branch())
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", args[0], err)
+	}
+
+	var t struct {
+		GoImport string `json:"goImport"`
+		GoSource string `json:"goSource"`
+		Releases string `json:"releases"`
+	}
+	if err := json.Unmarshal(out, &t); err != nil {
+		return nil, fmt.Errorf("%s: invalid output: %v", args[0], err)
+	}
+	return Custom{
+		Repo:     r,
+		goImport: t.GoImport,
+		goSource: moduleSource(t.GoSource, r),
+		releases: t.Releases,
+	}, nil
+}
+
+// moduleSource adjusts go-source meta tag content given for the root
+// of the repository r to the module at r.Dir within it, if the module
+// is in a subdirectory: its prefix is the module's, and its directories
+// are within the subdirectory. Content given for the module already is
+// returned unchanged.
+func moduleSource(goSource string, r Repo) string {
+	f := strings.Fields(goSource)
+	if r.Dir == "" || len(f) != 4 || f[0] != r.ImportPath {
+		return goSource
+	}
+	f[0] += "/" + r.Dir
+	dirs := moduleDirReplacer(r.Dir)
+	f[2], f[3] = dirs.Replace(f[2]), dirs.Replace(f[3])
+	return strings.Join(f, " ")
+}
+
+// moduleDirReplacer prefixes the directories in go-source URL templates
+// with dir, for a module in that subdirectory of its repository.
+func moduleDirReplacer(dir string) *strings.Replacer {
+	return strings.NewReplacer("{/dir}", "/"+dir+"{/dir}", "{dir}", dir+"{/dir}")
+}
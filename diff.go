@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// exitFindings is the exit status of commands that check output, such
+// as diff and lint, when they find a problem.
+const exitFindings = 5
+
+// diffMain implements the diff command, which compares the output that
+// would be generated with the files deployed on each domain, or at a
+// base URL.
+func diffMain(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = usage
+	addFlags(fs)
+	base := fs.String("base", "", "URL serving the files of a single domain in its place, such as a staging deployment (default https:// each file's domain)")
+	fs.Parse(args)
+
+	mem := make(memDestination)
+	dest = mem
+	generate(fs.Args())
+
+	names := make([]string, 0, len(mem))
+	domains := make(map[string]bool)
+	for name := range mem {
+		names = append(names, name)
+		domain, _, _ := strings.Cut(name, "/")
+		domains[domain] = true
+	}
+	sort.Strings(names)
+	if *base != "" && len(domains) > 1 {
+		exitOnErr(fmt.Errorf("diff: -base serves a single domain, but files are generated for %d", len(domains)), exitUsage)
+	}
+
+	var stale int
+	for _, name := range names {
+		status, err := compare(deployedURL(*base, name), mem[name].Bytes(), contentType(name))
+		exitOnErr(err, exitError)
+		if status != "" {
+			fmt.Printf("%s: %s\n", name, status)
+			stale++
+		}
+	}
+
+	if summaryFlag {
+		stats.print(os.Stderr)
+	}
+	if stale > 0 {
+		os.Exit(exitFindings)
+	}
+}
+
+// deployedURL returns the URL at which the generated file name is
+// served: on the domain leading its name, or at base in its place if
+// that is set.
+func deployedURL(base, name string) string {
+	domain, rest, _ := strings.Cut(name, "/")
+	if base == "" {
+		base = "https://" + domain
+		if insecureFlag {
+			base = "http://" + domain
+		}
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimSuffix(rest, "index.html")
+}
+
+// compare fetches rawurl and describes how it differs from want, served
+// as ctype, or returns an empty string if it is up to date.
+func compare(rawurl string, want []byte, ctype string) (string, error) {
+	resp, err := http.Get(rawurl)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "not deployed", nil
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%s: unexpected status %s", rawurl, resp.Status)
+	}
+
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(got, want) {
+		return "out of date", nil
+	}
+
+	// Hosts commonly serve pages without a charset, or as a download,
+	// unless the type is set on each object.
+	if ctype == htmlType && !isHTMLType(resp.Header.Get("Content-Type")) {
+		return fmt.Sprintf("served as %q, want %q", resp.Header.Get("Content-Type"), htmlType), nil
+	}
+	return "", nil
+}
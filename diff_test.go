@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestDeployedURL(t *testing.T) {
+	tests := []struct {
+		base, name, want string
+	}{
+		{"", "vanity.example.com/foo/index.html", "https://vanity.example.com/foo/"},
+		{"", "go.example.org/index.html", "https://go.example.org/"},
+		{"", "www.vanity.example.com/foo/index.html", "https://www.vanity.example.com/foo/"},
+		{"", "vanity.example.com/_headers", "https://vanity.example.com/_headers"},
+		{"https://staging.example.com/", "vanity.example.com/foo/index.html", "https://staging.example.com/foo/"},
+	}
+	for _, tt := range tests {
+		if got := deployedURL(tt.base, tt.name); got != tt.want {
+			t.Errorf("deployedURL(%q, %q) = %q, want %q", tt.base, tt.name, got, tt.want)
+		}
+	}
+}
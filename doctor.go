@@ -0,0 +1,377 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// doctorMain implements the doctor command, which checks the
+// environment that vanity runs in and the vanity domains it serves,
+// printing what to do about each problem found.
+func doctorMain(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = usage
+	addFlags(fs)
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for each network check")
+	fs.Parse(args)
+
+	if configFlag != "" {
+		var err error
+		config, err = loadConfig(configFlag)
+		exitOnErr(err, exitUsage)
+	}
+	// The modules in the input, if any is named, are checked in
+	// preference to the paths configured. Their pages are generated
+	// in memory only.
+	var modules []string
+	if jsonFlag != "" || reposFlag != "" || dirFlag != "" || len(fileFlag) > 0 {
+		dest = make(memDestination)
+		g := generate(nil)
+		for _, e := range g.entries {
+			if f := strings.Fields(e.VCS.GoImport()); len(f) == 3 {
+				modules = append(modules, f[0])
+			}
+		}
+	}
+	domains := fs.Args()
+	if len(domains) == 0 {
+		domains = configDomains(config)
+		for _, m := range modules {
+			if domain, _, _ := strings.Cut(m, "/"); !contains(domains, domain) {
+				domains = append(domains, domain)
+			}
+		}
+	}
+
+	d := &doctor{out: os.Stdout, timeout: *timeout, modules: modules}
+	d.checkBuild()
+	d.checkVCS()
+	d.checkCredentials()
+	for _, domain := range domains {
+		d.checkDomain(domain)
+	}
+
+	if d.failed > 0 {
+		os.Exit(exitFindings)
+	}
+}
+
+// doctor prints the results of the checks made by the doctor command.
+type doctor struct {
+	out     io.Writer
+	timeout time.Duration
+	modules []string // module paths generated from the input
+	failed  int
+}
+
+// ok reports a check that passed.
+func (d *doctor) ok(check, format string, args ...any) {
+	fmt.Fprint(d.out, redact(fmt.Sprintf("ok    %s: %s\n", check, fmt.Sprintf(format, args...))))
+}
+
+// warn reports a check that could not be made, with what to do so that
+// it can be.
+func (d *doctor) warn(check, problem, fix string) {
+	fmt.Fprint(d.out, redact(fmt.Sprintf("WARN  %s: %s\n      %s\n", check, problem, fix)))
+}
+
+// fail reports a check that failed, with what to do about it.
+func (d *doctor) fail(check, problem, fix string) {
+	d.failed++
+	fmt.Fprint(d.out, redact(fmt.Sprintf("FAIL  %s: %s\n      %s\n", check, problem, fix)))
+}
+
+// checkBuild checks that packages named as arguments can be found.
+func (d *doctor) checkBuild() {
+	if _, err := exec.LookPath("go"); err != nil {
+		d.fail("go", "not found in $PATH",
+			"Install Go, which finds packages named as arguments in module mode; or use -json, -repos or -dir.")
+	}
+
+	// build.Import resolves packages in a module when one is found
+	// above the working directory, unless modules are turned off.
+	mode := os.Getenv("GO111MODULE")
+	if gomod := findGoMod("."); gomod != "" && mode != "off" {
+		d.fail("GO111MODULE", fmt.Sprintf("packages are resolved in the module of %s", gomod),
+			"Set GO111MODULE=off to find them in GOPATH instead, or run vanity outside the module.")
+		return
+	}
+	var dirs []string
+	for _, dir := range filepath.SplitList(build.Default.GOPATH) {
+		if fi, err := os.Stat(filepath.Join(dir, "src")); err == nil && fi.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		d.fail("GOPATH", fmt.Sprintf("no src directory in %s", build.Default.GOPATH),
+			"Check out the repositories beneath $GOPATH/src, or use -json, -repos or -dir.")
+		return
+	}
+	d.ok("GOPATH", "%s", strings.Join(dirs, string(filepath.ListSeparator)))
+}
+
+// findGoMod returns the go.mod file in dir or the closest directory
+// above it, or an empty string if there is none.
+func findGoMod(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		name := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// checkVCS checks that git, needed to find the root of each repository
+// and to audit them, can be run.
+func (d *doctor) checkVCS() {
+	out, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		d.fail("git", err.Error(),
+			"Install git, which is needed to find the repository of each package.")
+		return
+	}
+	d.ok("git", "%s", strings.TrimSpace(string(out)))
+}
+
+// checkCredentials checks the tokens used with the provider APIs, if
+// they are set.
+func (d *doctor) checkCredentials() {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := getJSON("https://api.github.com/user", "Authorization", bearer(token), &user); err != nil {
+			d.fail("GITHUB_TOKEN", err.Error(),
+				"Create a new token, or unset GITHUB_TOKEN to make anonymous requests.")
+		} else {
+			d.ok("GITHUB_TOKEN", "authenticates as %s", user.Login)
+		}
+	} else if topicsFlag {
+		d.ok("GITHUB_TOKEN", "not set, so -topics may exceed GitHub's limit on anonymous requests")
+	}
+
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return
+	}
+	hosts := []string{"gitlab.com"}
+	for host, hc := range config.Hosts {
+		if hc.Provider == "gitlab" {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts[1:])
+	for _, host := range hosts {
+		var user struct {
+			Username string `json:"username"`
+		}
+		if err := getJSON("https://"+host+"/api/v4/user", "PRIVATE-TOKEN", token, &user); err != nil {
+			d.fail("GITLAB_TOKEN", err.Error(),
+				"Create a new token on "+host+", or unset GITLAB_TOKEN to make anonymous requests.")
+		} else {
+			d.ok("GITLAB_TOKEN", "authenticates as %s on %s", user.Username, host)
+		}
+	}
+}
+
+// checkDomain checks that the vanity domain resolves, serves HTTPS with
+// a certificate the go command trusts, and serves a page for the go
+// command.
+func (d *doctor) checkDomain(domain string) {
+	addrs, err := net.LookupHost(domain)
+	if err != nil {
+		d.fail(domain, err.Error(),
+			"Create DNS records for the domain pointing at the host serving its pages.")
+		return
+	}
+	d.ok(domain, "resolves to %s", strings.Join(addrs, ", "))
+
+	dialer := &net.Dialer{Timeout: d.timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(domain, "443"), &tls.Config{ServerName: domain})
+	if err != nil {
+		d.fail(domain, err.Error(),
+			"Serve the domain over HTTPS with a certificate for it from a trusted authority, as the go command requires.")
+		return
+	}
+	conn.Close()
+	cert := conn.ConnectionState().PeerCertificates[0]
+	if left := time.Until(cert.NotAfter); left < certExpiryWarning {
+		d.fail(domain, fmt.Sprintf("certificate expires %s", cert.NotAfter.Format(time.DateOnly)),
+			"Renew the certificate, or check that automatic renewal is working.")
+	} else {
+		d.ok(domain, "serves HTTPS with a certificate from %s", cert.Issuer.CommonName)
+	}
+
+	sample, ok := samplePath(config, d.modules, domain)
+	if !ok {
+		d.warn(domain, "no import path on the domain is known, so its pages are not checked",
+			"Name the packages served with -json, -repos, -dir or -f, or configure paths on the domain in -config.")
+		return
+	}
+	d.checkPage(sample)
+	d.checkProxy(sample)
+}
+
+// certExpiryWarning is how soon before its certificate expires that a
+// vanity domain is reported.
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// checkPage checks that the page for importPath is served to the go
+// command: over HTTPS throughout any redirects, and with a go-import
+// meta tag for the path.
+func (d *doctor) checkPage(importPath string) {
+	var insecure bool
+	client := &http.Client{
+		Timeout: d.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// The go command refuses to follow a redirect
+			// to HTTP.
+			if req.URL.Scheme != "https" {
+				insecure = true
+				return fmt.Errorf("redirected to %s", req.URL)
+			}
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+	rawurl := "https://" + importPath + "?go-get=1"
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		fix := "Check that the host serving the domain is running."
+		if insecure {
+			fix = "Serve the pages over HTTPS only, without redirecting to HTTP."
+		}
+		d.fail(importPath, err.Error(), fix)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		d.fail(importPath, fmt.Sprintf("%s: %s", rawurl, resp.Status),
+			"Upload the pages, and check that the host serves each path/index.html for /path.")
+		return
+	}
+
+	goImport, _ := readMeta(resp.Body)
+	f := strings.Fields(goImport)
+	if len(f) != 3 || (importPath != f[0] && !strings.HasPrefix(importPath, f[0]+"/")) {
+		d.fail(importPath, fmt.Sprintf("%s: no go-import meta tag for the path", rawurl),
+			"Upload the pages generated for the domain, rather than other files.")
+		return
+	}
+	d.ok(importPath, "served with go-import %q", goImport)
+}
+
+// checkProxy checks that the public module proxy can resolve the
+// latest version of the module at modulePath, as go get does by
+// default. Failures there can differ from fetching the module directly,
+// and the proxy remembers them for a while.
+func (d *doctor) checkProxy(modulePath string) {
+	patterns := os.Getenv("GONOPROXY")
+	if patterns == "" {
+		patterns = os.Getenv("GOPRIVATE")
+	}
+	if matchPrefixPatterns(patterns, modulePath) {
+		d.ok(modulePath, "fetched directly rather than through proxy.golang.org, as matched by GONOPROXY or GOPRIVATE")
+		return
+	}
+
+	client := &http.Client{Timeout: d.timeout}
+	rawurl := "https://proxy.golang.org/" + escapeModulePath(modulePath) + "/@latest"
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		d.fail(modulePath, fmt.Sprintf("probing proxy.golang.org: %v", err),
+			"Check that proxy.golang.org can be reached, or set GOPROXY to the proxy in use.")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// The proxy explains why it cannot resolve a module in
+		// the body of its response.
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		d.fail(modulePath, fmt.Sprintf("proxy.golang.org: %s: %s", resp.Status, strings.TrimSpace(string(b))),
+			"Fix the error, then check again with GOPROXY=direct go list -m "+modulePath+"@latest, as the proxy remembers it for a while; or add the domain to GOPRIVATE if its modules are private.")
+		return
+	}
+	var info struct {
+		Version string
+		Time    time.Time
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		d.fail(modulePath, fmt.Sprintf("proxy.golang.org: %v", err),
+			"Check again later; the proxy may be failing.")
+		return
+	}
+	d.ok(modulePath, "proxy.golang.org resolves %s, published %s", info.Version, info.Time.Format(time.DateOnly))
+}
+
+// samplePath returns an import path on domain whose page should be
+// served: the first of the modules generated on the domain, or else
+// the first path configured beneath it. It reports false if there is
+// none, as the domain alone need not have a page.
+func samplePath(c Config, modules []string, domain string) (string, bool) {
+	sorted := append([]string(nil), modules...)
+	sort.Strings(sorted)
+	for _, p := range sorted {
+		if p == domain || strings.HasPrefix(p, domain+"/") {
+			return p, true
+		}
+	}
+
+	var paths []string
+	for p := range c.Paths {
+		paths = append(paths, p)
+	}
+	paths = append(paths, c.Allow...)
+	sort.Strings(paths)
+	for _, p := range paths {
+		if strings.HasPrefix(p, domain+"/") {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// configDomains returns the vanity domains named in the configuration.
+func configDomains(c Config) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	add := func(importPath string) {
+		domain, _, _ := strings.Cut(importPath, "/")
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	for _, p := range c.Allow {
+		add(p)
+	}
+	for p := range c.Paths {
+		add(p)
+	}
+	sort.Strings(domains)
+	return domains
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestSamplePath(t *testing.T) {
+	c := Config{
+		Allow: []string{"vanity.example.com/tools"},
+		Paths: map[string]PathConfig{"other.example.com/zed": {}},
+	}
+	modules := []string{"vanity.example.com/yaml.v2", "vanity.example.com/foo", "root.example.com"}
+
+	tests := []struct {
+		modules []string
+		domain  string
+		want    string
+		ok      bool
+	}{
+		{modules, "vanity.example.com", "vanity.example.com/foo", true},
+		{modules, "root.example.com", "root.example.com", true},
+		{modules, "other.example.com", "other.example.com/zed", true},
+		{nil, "vanity.example.com", "vanity.example.com/tools", true},
+		{modules, "unknown.example.com", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := samplePath(c, tt.modules, tt.domain)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("samplePath(%q) = %q, %v, want %q, %v", tt.domain, got, ok, tt.want, tt.ok)
+		}
+	}
+}
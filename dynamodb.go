@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// dynamoRenew is how long credentials obtained by assuming a role are
+// used before they are renewed, short of the hour they last.
+const dynamoRenew = 50 * time.Minute
+
+// dynamoStore reads mappings from a DynamoDB table, whose items have
+// the import path as their partition key "path" and the repository in
+// the attribute "repository".
+type dynamoStore struct {
+	client   *http.Client
+	endpoint string
+	table    string
+	cfg      *awsConfig
+
+	mu    sync.Mutex
+	creds awsCredentials
+	renew time.Time // when creds for a role are renewed
+}
+
+// newDynamoStore returns a store for the table, in the region and with
+// the credentials given by loadAWSConfig. The endpoint of DynamoDB may
+// be set by AWS_ENDPOINT_URL_DYNAMODB, such as for DynamoDB Local.
+func newDynamoStore(table string) (*dynamoStore, error) {
+	cfg, err := loadAWSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("dynamodb: %v", err)
+	}
+	s := &dynamoStore{
+		client:   &http.Client{Timeout: 5 * time.Second},
+		endpoint: os.Getenv("AWS_ENDPOINT_URL_DYNAMODB"),
+		table:    table,
+		cfg:      cfg,
+		creds:    cfg.creds,
+	}
+	if s.endpoint == "" {
+		s.endpoint = "https://dynamodb." + cfg.region + ".amazonaws.com/"
+	}
+	if cfg.roleARN == "" && (s.creds.accessKey == "" || s.creds.secretKey == "") {
+		return nil, fmt.Errorf("dynamodb: no credentials")
+	}
+	return s, nil
+}
+
+// credentials returns the credentials with which to sign requests,
+// assuming the configured role again once its credentials are old.
+func (s *dynamoStore) credentials() (awsCredentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cfg.roleARN == "" || time.Now().Before(s.renew) {
+		return s.creds, nil
+	}
+	creds, err := assumeRole(s.cfg)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("dynamodb: %v", err)
+	}
+	s.creds, s.renew = creds, time.Now().Add(dynamoRenew)
+	return creds, nil
+}
+
+func (s *dynamoStore) Get(importPath string) (string, error) {
+	creds, err := s.credentials()
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]any{
+		"TableName":            s.table,
+		"Key":                  map[string]any{"path": map[string]string{"S": importPath}},
+		"ProjectionExpression": "repository",
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810.GetItem")
+	if creds.token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.token)
+	}
+	sum := sha256.Sum256(body)
+	signV4(req, "dynamodb", s.cfg.region, creds.accessKey, creds.secretKey, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("dynamodb: %v", err)
+	}
+	defer resp.Body.Close()
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", fmt.Errorf("dynamodb: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(msg, &e)
+		return "", fmt.Errorf("dynamodb: %s: %s %s", resp.Status, e.Type, e.Message)
+	}
+	var r struct {
+		Item struct {
+			Repository struct {
+				S string
+			} `json:"repository"`
+		}
+	}
+	if err := json.Unmarshal(msg, &r); err != nil {
+		return "", fmt.Errorf("dynamodb: %v", err)
+	}
+	return r.Item.Repository.S, nil
+}
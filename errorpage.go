@@ -0,0 +1,68 @@
+package main
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// errorPage is the name of the page written at the root of each domain
+// by -error-page. Netlify and Cloudflare Pages serve it for missing
+// paths without further configuration, and it should be given as the
+// error document of an S3 website.
+const errorPage = "404.html"
+
+// writeErrorPages creates the error page at the root of each domain
+// with written pages.
+func writeErrorPages(written map[string]bool) error {
+	for _, domain := range domains(written) {
+		var paths []string
+		for importPath := range written {
+			if importPath == domain || strings.HasPrefix(importPath, domain+"/") {
+				paths = append(paths, importPath)
+			}
+		}
+		sort.Strings(paths)
+
+		data := struct {
+			Domain string
+			Lang   string
+			Msg    messages
+			Paths  []string
+			Config Config
+		}{
+			Domain: domain,
+			Lang:   langFlag,
+			Msg:    lookupMessages(langFlag),
+			Paths:  paths,
+			Config: config,
+		}
+		if err := execute(domain+"/"+errorPage, errorTpl, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errorTpl is the default error page, listing the paths on the domain.
+var errorTpl = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ printf .Msg.NotFoundTitle .Domain }}</title>
+</head>
+<body>
+<h1>{{ .Msg.NotFound }}</h1>
+<p>{{ printf .Msg.NoPackage .Domain }}</p>
+{{- with .Paths }}
+<p>{{ $.Msg.Packages }}</p>
+<ul>
+{{- range . }}
+<li><a href="https://{{ . }}">{{ . }}</a></li>
+{{- end }}
+</ul>
+{{- end }}
+</body>
+</html>
+`))
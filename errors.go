@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors describing why an import path could not be resolved. They are
+// wrapped in a PathError naming the path, and may be tested for with
+// errors.Is.
+var (
+	// ErrInvalidImportPath is returned for a path that cannot be an
+	// import path at all.
+	ErrInvalidImportPath = errors.New("invalid import path")
+
+	// ErrNoVCSRoot is returned when the repository holding a
+	// package cannot be determined.
+	ErrNoVCSRoot = errors.New("cannot find version control repository")
+
+	// ErrUnknownProvider is returned when configuration names a
+	// provider that does not exist.
+	ErrUnknownProvider = errors.New("unknown provider")
+
+	// ErrNoReplacement is returned when no replacement maps an
+	// import path to a repository elsewhere, so that go get would
+	// be sent back to the vanity domain.
+	ErrNoReplacement = errors.New("not changed by any -replace pair or configured replacement, so go get would loop back to the vanity domain")
+
+	// ErrNotAllowed is returned for a path outside those allowed by
+	// the configuration.
+	ErrNotAllowed = errors.New("not in the allowed paths")
+)
+
+// PathError records an error resolving an import path.
+type PathError struct {
+	ImportPath string
+	Err        error
+}
+
+func (e *PathError) Error() string { return e.ImportPath + ": " + e.Err.Error() }
+func (e *PathError) Unwrap() error { return e.Err }
+
+// checkReplaced returns an error if repository, to which the import
+// path root was mapped, is root itself.
+func checkReplaced(root, repository string) error {
+	if repository == root {
+		return &PathError{ImportPath: root, Err: ErrNoReplacement}
+	}
+	return nil
+}
+
+// checkImportPath returns an error if importPath is not a plausible
+// import path: empty, rooted, with empty or dot elements, or holding
+// characters the go command rejects.
+func checkImportPath(importPath string) error {
+	if importPath == "" {
+		return &PathError{ImportPath: importPath, Err: fmt.Errorf("%w: empty", ErrInvalidImportPath)}
+	}
+	for _, elem := range strings.Split(importPath, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return &PathError{ImportPath: importPath, Err: fmt.Errorf("%w: empty or dot element", ErrInvalidImportPath)}
+		}
+	}
+	for _, r := range importPath {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("-._~+/", r)) {
+			return &PathError{ImportPath: importPath, Err: fmt.Errorf("%w: character %q", ErrInvalidImportPath, r)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// mapping is the resolved mapping of an import path, as printed by the
+// export command.
+type mapping struct {
+	ImportPath string `json:"importPath"`
+	Repository string `json:"repository"`
+	VCS        string `json:"vcs"`
+	Branch     string `json:"branch"`
+
+	// File is the page for the import path, relative to the
+	// output directory.
+	File string `json:"file"`
+}
+
+// exporters write mappings in each format accepted by -format.
+var exporters = map[string]func(w io.Writer, mappings []mapping) error{
+	"csv":  exportCSV,
+	"json": exportJSON,
+}
+
+// exportMain implements the export command, which prints the mapping
+// of each import path to its repository rather than generating pages.
+func exportMain(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.Usage = usage
+	addFlags(fs)
+	format := fs.String("format", "json", `output format: "json" or "csv"`)
+	fs.Parse(args)
+
+	export, ok := exporters[*format]
+	if !ok {
+		exitOnErr(fmt.Errorf("invalid -format %q", *format), exitUsage)
+	}
+
+	// Pages are generated only to resolve each mapping, and are
+	// discarded.
+	dest = make(memDestination)
+	g := generate(fs.Args())
+
+	mappings := make([]mapping, 0, len(g.entries))
+	for _, e := range g.entries {
+		m := mapping{
+			ImportPath: e.ImportPath,
+			Repository: e.Repository,
+			Branch:     e.Branch,
+			File:       path.Join(e.ImportPath, "index.html"),
+		}
+
+		// The go-import meta tag holds the resolved version
+		// control system and repository URL.
+		if f := strings.Fields(e.VCS.GoImport()); len(f) == 3 {
+			m.VCS = f[1]
+			m.Repository = f[2]
+		}
+		// A repository URL may carry credentials, which have
+		// no place in a report.
+		m.Repository = redact(m.Repository)
+		mappings = append(mappings, m)
+	}
+
+	err := export(os.Stdout, mappings)
+	exitOnErr(err, exitOutput)
+
+	if summaryFlag {
+		stats.print(os.Stderr)
+	}
+}
+
+// exportJSON writes mappings to w as a JSON array.
+func exportJSON(w io.Writer, mappings []mapping) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(mappings)
+}
+
+// exportCSV writes mappings to w as CSV with a header row.
+func exportCSV(w io.Writer, mappings []mapping) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"import_path", "repository", "vcs", "branch", "file"})
+	for _, m := range mappings {
+		cw.Write([]string{m.ImportPath, m.Repository, m.VCS, m.Branch, m.File})
+	}
+	cw.Flush()
+	return cw.Error()
+}
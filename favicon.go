@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// iconFiles are the files that browsers request from the root of a
+// domain, whether or not a page links to them.
+var iconFiles = []string{
+	"favicon.ico",
+	"favicon.png",
+	"apple-touch-icon.png",
+	"site.webmanifest",
+}
+
+// iconColor is the colour of the default icon, the Go gopher blue.
+var iconColor = color.RGBA{0x00, 0xad, 0xd8, 0xff}
+
+// writeFavicons creates the icons and web manifest at the root of each
+// domain with written pages. Files found in dir are copied; the rest
+// are generated.
+func writeFavicons(written map[string]bool, dir string) error {
+	for _, domain := range domains(written) {
+		files, err := iconSet(domain, dir)
+		if err != nil {
+			return err
+		}
+		for _, name := range iconFiles {
+			w, err := create(domain + "/" + name)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(files[name])
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// iconSet returns the contents of each of iconFiles for domain, read
+// from dir if it is not empty and has the file.
+func iconSet(domain, dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, name := range iconFiles {
+		if dir == "" {
+			break
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[name] = b
+	}
+
+	var err error
+	if files["favicon.png"] == nil {
+		files["favicon.png"], err = defaultIcon(32)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if files["favicon.ico"] == nil {
+		files["favicon.ico"] = pngICO(files["favicon.png"], 32)
+	}
+	if files["apple-touch-icon.png"] == nil {
+		files["apple-touch-icon.png"], err = defaultIcon(180)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if files["site.webmanifest"] == nil {
+		files["site.webmanifest"], err = webManifest(domain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// defaultIcon returns a square PNG image of size pixels in iconColor.
+func defaultIcon(size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, iconColor)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pngICO wraps a square PNG image of size pixels in an ICO file, which
+// may hold PNG images directly.
+func pngICO(img []byte, size int) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Reserved, Type, Count uint16
+	}{0, 1, 1})
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Width, Height, Colors, Reserved uint8
+		Planes, BitCount                uint16
+		Size, Offset                    uint32
+	}{uint8(size), uint8(size), 0, 0, 1, 32, uint32(len(img)), 22})
+	buf.Write(img)
+	return buf.Bytes()
+}
+
+// webManifest returns a web app manifest naming domain and its icons.
+func webManifest(domain string) ([]byte, error) {
+	type icon struct {
+		Src   string `json:"src"`
+		Sizes string `json:"sizes"`
+		Type  string `json:"type"`
+	}
+	return json.MarshalIndent(struct {
+		Name  string `json:"name"`
+		Icons []icon `json:"icons"`
+	}{
+		Name: domain,
+		Icons: []icon{
+			{"/favicon.png", "32x32", "image/png"},
+			{"/apple-touch-icon.png", "180x180", "image/png"},
+		},
+	}, "", "  ")
+}
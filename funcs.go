@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// templateFuncs are the functions available to templates given in
+// configuration or by flags, beyond those built into text/template and
+// html/template. As in sprig, the string being operated on comes last,
+// so that it may be piped in:
+//
+//	{{ .ImportPath | trimPrefix "vanity.example.com/" | upper }}
+var templateFuncs = map[string]any{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       func(sep string, a []string) string { return strings.Join(a, sep) },
+	"base":       path.Base,
+	"dir":        path.Dir,
+	"now":        time.Now,
+	"integrity":  integrity,
+	"asset":      assetURL,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// loadPageTemplate reads the html/template file name, for use in place
+// of the built-in page template base.
+//
+// A file holding only definitions of the base template's blocks, such
+// as "head", "meta", "body" and "footer" in the landing page, replaces
+// just those blocks:
+//
+//	{{ define "footer" }}<p>Maintained by Example Corp.</p>{{ end }}
+//
+// A file holding anything else replaces the whole page.
+func loadPageTemplate(name string, base *template.Template) (*template.Template, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	// Parsing into the copy of the base replaces its body only if
+	// the file has one.
+	if _, err := tpl.Funcs(templateFuncs).Parse(string(b)); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return tpl, nil
+}
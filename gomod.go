@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// goMod holds the parts of a go.mod file shown on pages.
+type goMod struct {
+	// Module is the module path.
+	Module string
+
+	// Go is the minimum version of Go required by the module.
+	Go string
+
+	Require []requirement
+}
+
+// requirement is a module required by a go.mod file.
+type requirement struct {
+	Path     string
+	Indirect bool
+}
+
+// readGoMod reads the go.mod file name, returning nil if it does not
+// exist. Only the module, go and require directives are read.
+func readGoMod(name string) (*goMod, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mod goMod
+	var inRequire bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "//"):
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire:
+			mod.Require = append(mod.Require, parseRequirement(line))
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require":
+			mod.Require = append(mod.Require, parseRequirement(strings.TrimPrefix(line, "require")))
+		case fields[0] == "module" && len(fields) >= 2:
+			mod.Module = strings.Trim(fields[1], `"`)
+		case fields[0] == "go" && len(fields) >= 2:
+			mod.Go = fields[1]
+		}
+	}
+	return &mod, scanner.Err()
+}
+
+// parseRequirement parses the module path and version of a require
+// directive, and any "// indirect" comment after them.
+func parseRequirement(line string) requirement {
+	spec, comment, _ := strings.Cut(line, "//")
+	var req requirement
+	if fields := strings.Fields(spec); len(fields) > 0 {
+		req.Path = strings.Trim(fields[0], `"`)
+	}
+	req.Indirect = strings.TrimSpace(comment) == "indirect"
+	return req
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// graph is the dependency graph of the modules on the vanity domains,
+// without any modules hosted elsewhere.
+type graph struct {
+	Nodes []string    `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// graphEdge is a requirement of one module on another.
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// buildGraph returns the graph of the modules of entries whose paths
+// are on the given domains.
+func buildGraph(entries []indexEntry, domains []string) graph {
+	onDomains := func(p string) bool {
+		domain, _, _ := strings.Cut(p, "/")
+		for _, d := range domains {
+			if d == domain {
+				return true
+			}
+		}
+		return false
+	}
+
+	var g graph
+	nodes := make(map[string]bool)
+	addNode := func(p string) {
+		if !nodes[p] {
+			nodes[p] = true
+			g.Nodes = append(g.Nodes, p)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.Module == nil || e.Module.Module == "" || !onDomains(e.Module.Module) || seen[e.Module.Module] {
+			continue
+		}
+		from := e.Module.Module
+		seen[from] = true
+		addNode(from)
+		for _, req := range e.Module.Require {
+			if onDomains(req.Path) {
+				addNode(req.Path)
+				g.Edges = append(g.Edges, graphEdge{From: from, To: req.Path})
+			}
+		}
+	}
+
+	sort.Strings(g.Nodes)
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// Requires returns the modules required by the module from.
+func (g graph) Requires(from string) []string {
+	var to []string
+	for _, e := range g.Edges {
+		if e.From == from {
+			to = append(to, e.To)
+		}
+	}
+	return to
+}
+
+// writeDOT writes g to w in the DOT language of Graphviz.
+func (g graph) writeDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph modules {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "\t%q;\n", n)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%q -> %q;\n", e.From, e.To)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// graphFormats write a graph in each format accepted by -format.
+var graphFormats = map[string]func(w io.Writer, g graph) error{
+	"dot": func(w io.Writer, g graph) error { return g.writeDOT(w) },
+	"json": func(w io.Writer, g graph) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(g)
+	},
+}
+
+// graphMain implements the graph command, which prints the dependency
+// graph of the modules on the vanity domains rather than generating
+// pages.
+func graphMain(args []string) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	fs.Usage = usage
+	addFlags(fs)
+	format := fs.String("format", "dot", `output format: "dot" or "json"`)
+	fs.Parse(args)
+
+	write, ok := graphFormats[*format]
+	if !ok {
+		exitOnErr(fmt.Errorf("invalid -format %q", *format), exitUsage)
+	}
+
+	// Pages are generated only to find each module, and are
+	// discarded.
+	dest = make(memDestination)
+	g := generate(fs.Args())
+
+	err := write(os.Stdout, buildGraph(g.entries, domains(g.written)))
+	exitOnErr(err, exitOutput)
+
+	if summaryFlag {
+		stats.print(os.Stderr)
+	}
+}
+
+// writeGraphs creates a page showing the dependency graph of the
+// modules on each domain with written pages, with the graph in DOT
+// beside it.
+func writeGraphs(entries []indexEntry, written map[string]bool) error {
+	msg := lookupMessages(langFlag)
+	for _, domain := range domains(written) {
+		g := buildGraph(entries, []string{domain})
+
+		w, err := create(domain + "/graph.dot")
+		if err != nil {
+			return err
+		}
+		err = g.writeDOT(w)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+
+		data := struct {
+			Domain string
+			Lang   string
+			Msg    messages
+			Graph  graph
+		}{
+			Domain: domain,
+			Lang:   langFlag,
+			Msg:    msg,
+			Graph:  g,
+		}
+		if err := execute(domain+"/graph.html", graphTpl, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var graphTpl = template.Must(template.New("graph").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ printf .Msg.Graph .Domain }}</title>
+</head>
+<body>
+<h1>{{ printf .Msg.Graph .Domain }}</h1>
+<dl>
+{{- range .Graph.Nodes }}
+<dt id="{{ . }}">{{ . }}</dt>
+{{- range $.Graph.Requires . }}
+<dd><a href="#{{ . }}">{{ . }}</a></dd>
+{{- end }}
+{{- end }}
+</dl>
+<p><a href="graph.dot">{{ .Msg.GraphDOT }}</a></p>
+</body>
+</html>
+`))
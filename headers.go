@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// headerRule declares the headers for requests matching a path.
+type headerRule struct {
+	Path    string
+	Headers [][2]string
+}
+
+// writeHeaders creates a _headers file at the root of each domain with
+// written pages, declaring security and caching headers for hosts such
+// as Netlify and Cloudflare Pages that read them.
+func writeHeaders(written map[string]bool) error {
+	for _, domain := range domains(written) {
+		data := struct {
+			Rules []headerRule
+		}{
+			Rules: append([]headerRule{{Path: "/*", Headers: securityHeaders()}}, cacheRules(domain, written)...),
+		}
+		if err := execute(domain+"/_headers", headersTpl, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// domains returns the sorted domains of the written import paths.
+func domains(written map[string]bool) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for importPath := range written {
+		domain, _, _ := strings.Cut(importPath, "/")
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// hstsMaxAge is how long, in seconds, browsers are told to use only
+// HTTPS for a vanity domain.
+const hstsMaxAge = 63072000
+
+// securityHeaders returns the headers that should be sent with every
+// generated file. Vanity domains must be served over HTTPS for go get
+// to trust them, so browsers are told never to use anything else,
+// unless -insecure is set for testing.
+func securityHeaders() [][2]string {
+	headers := [][2]string{
+		{"Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", hstsMaxAge)},
+		{"Content-Security-Policy", contentSecurityPolicy()},
+		{"X-Content-Type-Options", "nosniff"},
+	}
+	if insecureFlag {
+		headers = headers[1:]
+	}
+	return headers
+}
+
+// contentSecurityPolicy allows only the resources used by the
+// generated pages, including the inline scripts by their hashes and
+// the search index they fetch from the same domain.
+func contentSecurityPolicy() string {
+	var scripts []string
+	for _, s := range []string{searchScript, redirectScript} {
+		sum := sha256.Sum256([]byte(s))
+		scripts = append(scripts, "'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+	}
+	return strings.Join([]string{
+		"default-src 'none'",
+		"img-src 'self'",
+		"connect-src 'self'",
+		"style-src 'self'",
+		"script-src " + strings.Join(scripts, " "),
+		"base-uri 'none'",
+		"form-action 'none'",
+		"frame-ancestors 'none'",
+	}, "; ")
+}
+
+var headersTpl = texttemplate.Must(texttemplate.New("headers").Parse(`
+{{- range .Rules }}
+{{- .Path }}
+{{- range .Headers }}
+  {{ index . 0 }}: {{ index . 1 }}
+{{- end }}
+{{ end -}}
+`))
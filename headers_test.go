@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteHeaders(t *testing.T) {
+	mem := make(memDestination)
+	defer func(d destination) { dest = d }(dest)
+	dest = mem
+
+	if err := writeHeaders(map[string]bool{"vanity.example.com/foo": true}); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := mem["vanity.example.com/_headers"]
+	if !ok {
+		t.Fatal("no _headers written at the root of the domain")
+	}
+
+	var csp string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "Content-Security-Policy: "); ok {
+			csp = v
+		}
+	}
+	if csp == "" {
+		t.Fatalf("no Content-Security-Policy in _headers:\n%s", b)
+	}
+	// The index pages fetch search.json from the domain.
+	for _, directive := range []string{"default-src 'none'", "connect-src 'self'"} {
+		if !contains(strings.Split(csp, "; "), directive) {
+			t.Errorf("Content-Security-Policy %q lacks %q", csp, directive)
+		}
+	}
+}
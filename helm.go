@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+)
+
+// helmValues are the values of a Helm chart running the serve command,
+// as written by the helm command. The chart mounts Config and Packages
+// in the container, and runs vanity serve with Args.
+type helmValues struct {
+	// Domains are the vanity domains served, for the Ingress.
+	Domains []string `json:"domains"`
+
+	// Config is the configuration file, if one was given.
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// Packages is the -json document listing the package served at
+	// each import path, as resolved when the values were generated.
+	Packages Input `json:"packages"`
+
+	// Args are the arguments of the serve command.
+	Args []string `json:"args"`
+
+	TLS struct {
+		// Enabled is set unless -insecure is used, as the go
+		// command fetches pages only over HTTPS.
+		Enabled bool `json:"enabled"`
+
+		// SecretName is the Secret holding the certificate
+		// for the domains.
+		SecretName string `json:"secretName"`
+	} `json:"tls"`
+}
+
+// Where the chart mounts the files in the values.
+const (
+	helmConfigFile   = "/etc/vanity/vanity.json"
+	helmPackagesFile = "/etc/vanity/packages.json"
+)
+
+// helmMain implements the helm command, which resolves the packages
+// named as arguments and prints the values of a Helm chart running the
+// serve command in Kubernetes. The configuration file is included as
+// it is, so that it remains the single source of truth.
+func helmMain(args []string) {
+	fs := flag.NewFlagSet("helm", flag.ExitOnError)
+	fs.Usage = usage
+	addFlags(fs)
+	secret := fs.String("tls-secret", "vanity-tls", "name of the Secret holding the certificate for the domains")
+	fs.Parse(args)
+
+	// Pages are generated only to resolve each package, and are
+	// discarded.
+	dest = make(memDestination)
+	g := generate(fs.Args())
+
+	var v helmValues
+	if configFlag != "" {
+		// The file was loaded as JSON while generating, so it can
+		// be included without encoding it again.
+		b, err := os.ReadFile(configFlag)
+		exitOnErr(err, exitLoad)
+		v.Config = json.RawMessage(b)
+	}
+
+	for _, e := range g.entries {
+		p := InputPackage{
+			ImportPath: e.ImportPath,
+			Repository: e.Repository,
+			Dir:        e.Dir,
+			Branch:     e.Branch,
+		}
+		if f := strings.Fields(e.VCS.GoImport()); len(f) == 3 {
+			if f[0] != e.ImportPath {
+				p.Root = f[0]
+			}
+			p.VCS = f[1]
+		}
+		if e.Module != nil {
+			p.GoVersion = e.Module.Go
+		}
+		v.Packages.Packages = append(v.Packages.Packages, p)
+	}
+
+	v.Domains = domains(g.written)
+	v.Args = []string{"serve", "-json", helmPackagesFile}
+	if v.Config != nil {
+		v.Args = append(v.Args, "-config", helmConfigFile)
+	}
+	v.TLS.Enabled = !insecureFlag
+	v.TLS.SecretName = *secret
+
+	// JSON is also YAML, as Helm reads values.
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	exitOnErr(err, exitOutput)
+
+	if summaryFlag {
+		stats.print(os.Stderr)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import "strings"
+
+// messages are the text of the built-in pages in one language. Those
+// containing verbs are formatted with an import path, domain or count.
+type messages struct {
+	// Landing pages.
+	NothingHere string
+	DocsLink    string
+	Redirecting string
+	Seconds     string
+	Releases    string
+	Private     string
+	Requires    string
+	Clone       string
+
+	// Domain indexes.
+	Search        string
+	SearchDomain  string
+	Source        string
+	SourceOf      string
+	Other         string
+	GoVersion     string
+	Stats         string
+	PrivateDomain string
+	PageOf        string
+	Previous      string
+	Next          string
+
+	// Dependency graphs.
+	Graph    string
+	GraphDOT string
+
+	// Error pages.
+	NotFound      string
+	NotFoundTitle string
+	NoPackage     string
+	Packages      string
+
+	// Pages on aliases of a domain, and on domains being renamed.
+	Moved      string
+	Deprecated string
+
+	// Pages at the paths of removed modules.
+	Removed  string
+	Archived string
+}
+
+// catalog holds the messages for each language, by its primary
+// language subtag.
+var catalog = map[string]messages{
+	"en": {
+		NothingHere:   "Nothing to see here; see the",
+		DocsLink:      "documentation for %s",
+		Redirecting:   "Redirecting in",
+		Seconds:       "seconds.",
+		Releases:      "Release notes for %s",
+		Private:       "This module is private. Configure the go command to fetch it directly, without the public proxy or checksum database:",
+		Requires:      "Requires Go %s or later.",
+		Clone:         "To have the go command clone the repository over %s instead, configure git:",
+		Search:        "Search packages",
+		SearchDomain:  "Search packages on %s",
+		Source:        "source",
+		SourceOf:      "Source of %s",
+		Other:         "Other",
+		PageOf:        "Page %d of %d",
+		Previous:      "Previous",
+		Next:          "Next",
+		GoVersion:     "(Go %s)",
+		Stats:         "(%d packages, %d direct dependencies)",
+		PrivateDomain: "These modules are private. Configure the go command to fetch them directly, without the public proxy or checksum database:",
+		Graph:         "Module dependencies on %s",
+		GraphDOT:      "Graph in DOT",
+		NotFound:      "Not found",
+		NotFoundTitle: "Not found - %s",
+		NoPackage:     "There is no package at this path on %s.",
+		Packages:      "Packages on this domain:",
+		Moved:         "This page has moved to",
+		Deprecated:    "Deprecated: %s has moved to %s. Update your imports to the new path.",
+		Removed:       "%s has been removed and is no longer maintained.",
+		Archived:      "Its last version remains available from",
+	},
+	"de": {
+		NothingHere:   "Hier gibt es nichts zu sehen; siehe die",
+		DocsLink:      "Dokumentation für %s",
+		Redirecting:   "Weiterleitung in",
+		Seconds:       "Sekunden.",
+		Releases:      "Versionshinweise für %s",
+		Private:       "Dieses Modul ist privat. Konfigurieren Sie den go-Befehl so, dass er es direkt abruft, ohne den öffentlichen Proxy oder die Prüfsummendatenbank:",
+		Requires:      "Erfordert Go %s oder neuer.",
+		Clone:         "Damit der go-Befehl das Repository stattdessen über %s klont, konfigurieren Sie git:",
+		Search:        "Pakete durchsuchen",
+		SearchDomain:  "Pakete auf %s durchsuchen",
+		Source:        "Quelltext",
+		SourceOf:      "Quelltext von %s",
+		Other:         "Sonstige",
+		PageOf:        "Seite %d von %d",
+		Previous:      "Zurück",
+		Next:          "Weiter",
+		GoVersion:     "(Go %s)",
+		Stats:         "(%d Pakete, %d direkte Abhängigkeiten)",
+		PrivateDomain: "Diese Module sind privat. Konfigurieren Sie den go-Befehl so, dass er sie direkt abruft, ohne den öffentlichen Proxy oder die Prüfsummendatenbank:",
+		Graph:         "Modulabhängigkeiten auf %s",
+		GraphDOT:      "Graph im DOT-Format",
+		NotFound:      "Nicht gefunden",
+		NotFoundTitle: "Nicht gefunden - %s",
+		NoPackage:     "Unter diesem Pfad gibt es auf %s kein Paket.",
+		Packages:      "Pakete auf dieser Domain:",
+		Moved:         "Diese Seite ist umgezogen nach",
+		Deprecated:    "Veraltet: %s ist nach %s umgezogen. Aktualisieren Sie Ihre Importe auf den neuen Pfad.",
+		Removed:       "%s wurde entfernt und wird nicht mehr gepflegt.",
+		Archived:      "Die letzte Version ist weiterhin verfügbar unter",
+	},
+	"es": {
+		NothingHere:   "No hay nada que ver aquí; consulte la",
+		DocsLink:      "documentación de %s",
+		Redirecting:   "Redirigiendo en",
+		Seconds:       "segundos.",
+		Releases:      "Notas de la versión de %s",
+		Private:       "Este módulo es privado. Configure el comando go para obtenerlo directamente, sin el proxy público ni la base de datos de sumas de comprobación:",
+		Requires:      "Requiere Go %s o posterior.",
+		Clone:         "Para que el comando go clone el repositorio mediante %s en su lugar, configure git:",
+		Search:        "Buscar paquetes",
+		SearchDomain:  "Buscar paquetes en %s",
+		Source:        "código fuente",
+		SourceOf:      "Código fuente de %s",
+		Other:         "Otros",
+		PageOf:        "Página %d de %d",
+		Previous:      "Anterior",
+		Next:          "Siguiente",
+		GoVersion:     "(Go %s)",
+		Stats:         "(%d paquetes, %d dependencias directas)",
+		PrivateDomain: "Estos módulos son privados. Configure el comando go para obtenerlos directamente, sin el proxy público ni la base de datos de sumas de comprobación:",
+		Graph:         "Dependencias entre módulos en %s",
+		GraphDOT:      "Grafo en formato DOT",
+		NotFound:      "No encontrado",
+		NotFoundTitle: "No encontrado - %s",
+		NoPackage:     "No hay ningún paquete en esta ruta de %s.",
+		Packages:      "Paquetes en este dominio:",
+		Moved:         "Esta página se ha trasladado a",
+		Deprecated:    "Obsoleto: %s se ha trasladado a %s. Actualice sus importaciones a la nueva ruta.",
+		Removed:       "%s se ha eliminado y ya no se mantiene.",
+		Archived:      "Su última versión sigue disponible en",
+	},
+	"fr": {
+		NothingHere:   "Rien à voir ici ; consultez la",
+		DocsLink:      "documentation de %s",
+		Redirecting:   "Redirection dans",
+		Seconds:       "secondes.",
+		Releases:      "Notes de version de %s",
+		Private:       "Ce module est privé. Configurez la commande go pour le récupérer directement, sans le proxy public ni la base de données de sommes de contrôle :",
+		Requires:      "Nécessite Go %s ou ultérieur.",
+		Clone:         "Pour que la commande go clone plutôt le dépôt via %s, configurez git :",
+		Search:        "Rechercher des paquets",
+		SearchDomain:  "Rechercher des paquets sur %s",
+		Source:        "source",
+		SourceOf:      "Source de %s",
+		Other:         "Autres",
+		PageOf:        "Page %d sur %d",
+		Previous:      "Précédente",
+		Next:          "Suivante",
+		GoVersion:     "(Go %s)",
+		Stats:         "(%d paquets, %d dépendances directes)",
+		PrivateDomain: "Ces modules sont privés. Configurez la commande go pour les récupérer directement, sans le proxy public ni la base de données de sommes de contrôle :",
+		Graph:         "Dépendances entre modules sur %s",
+		GraphDOT:      "Graphe au format DOT",
+		NotFound:      "Introuvable",
+		NotFoundTitle: "Introuvable - %s",
+		NoPackage:     "Il n'y a aucun paquet à ce chemin sur %s.",
+		Packages:      "Paquets sur ce domaine :",
+		Moved:         "Cette page a été déplacée vers",
+		Deprecated:    "Obsolète : %s a été déplacé vers %s. Mettez à jour vos imports vers le nouveau chemin.",
+		Removed:       "%s a été supprimé et n'est plus maintenu.",
+		Archived:      "Sa dernière version reste disponible sur",
+	},
+}
+
+// lookupMessages returns the messages for the language tag lang, such
+// as "en-AU", falling back to English for languages not in catalog.
+func lookupMessages(lang string) messages {
+	primary, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	if m, ok := catalog[primary]; ok {
+		return m
+	}
+	return catalog["en"]
+}
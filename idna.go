@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// asciiDomain returns the path p, such as an import path or repository,
+// with an internationalized domain as its first element converted to
+// the punycode form that the go command and DNS require. Other
+// elements must already be ASCII, as the go command allows nothing
+// else in import paths.
+func asciiDomain(p string) (string, error) {
+	domain, rest, found := strings.Cut(p, "/")
+	if isASCII(domain) {
+		return p, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", &PathError{ImportPath: p, Err: fmt.Errorf("%w: %v", ErrInvalidImportPath, err)}
+	}
+	if found {
+		ascii += "/" + rest
+	}
+	return ascii, nil
+}
+
+// isASCII reports whether s holds only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiDomains converts each of the paths with asciiDomain.
+func asciiDomains(paths []string) ([]string, error) {
+	for i, p := range paths {
+		var err error
+		if paths[i], err = asciiDomain(p); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
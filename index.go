@@ -0,0 +1,525 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"unicode"
+)
+
+// indexEntry is a path listed on a domain index.
+type indexEntry struct {
+	ImportPath string
+	Docs       string
+	Repository string
+	Dir        string
+	Branch     string
+	Tags       []string
+	Module     *goMod
+	Stats      *moduleStats
+	VCS        Provider
+}
+
+// indexGroup is a category of entries on a domain index. An index of
+// entries without any tags has a single group with no name.
+type indexGroup struct {
+	Name    string
+	Entries []indexEntry
+}
+
+// groupEntries groups entries by their tags, sorted by name with any
+// untagged entries last, in a group named other. An entry appears
+// under each of its tags.
+func groupEntries(entries []indexEntry, other string) []indexGroup {
+	byTag := make(map[string][]indexEntry)
+	var untagged []indexEntry
+	for _, e := range entries {
+		seen := make(map[string]bool)
+		for _, tag := range e.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				byTag[tag] = append(byTag[tag], e)
+			}
+		}
+		if len(e.Tags) == 0 {
+			untagged = append(untagged, e)
+		}
+	}
+
+	if len(byTag) == 0 {
+		return []indexGroup{{Entries: untagged}}
+	}
+
+	var groups []indexGroup
+	for tag, entries := range byTag {
+		groups = append(groups, indexGroup{Name: tag, Entries: entries})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	if len(untagged) > 0 {
+		groups = append(groups, indexGroup{Name: other, Entries: untagged})
+	}
+	return groups
+}
+
+// fetchTopics adds the topics of each entry's repository to its tags,
+// for entries whose provider supports topics, however it is wrapped.
+func fetchTopics(entries []indexEntry) error {
+	cache := make(map[string][]string)
+	for i, e := range entries {
+		p, ok := baseProvider(e.VCS).(topicsProvider)
+		if !ok {
+			continue
+		}
+
+		topics, ok := cache[e.Repository]
+		if !ok {
+			var err error
+			topics, err = p.Topics()
+			if err != nil {
+				return err
+			}
+			cache[e.Repository] = topics
+		}
+		// Copy the tags, which may be shared with the configuration.
+		entries[i].Tags = append(append([]string(nil), e.Tags...), topics...)
+	}
+	return nil
+}
+
+// writeIndexes creates an index page listing entries, and an
+// OpenSearch descriptor for searching it, at the root of each domain.
+// A domain whose root already has a page is left untouched.
+func writeIndexes(entries []indexEntry, written map[string]bool) error {
+	domains := make(map[string][]indexEntry)
+	for _, e := range entries {
+		domain, _, _ := strings.Cut(e.ImportPath, "/")
+		domains[domain] = append(domains[domain], e)
+	}
+
+	msg := lookupMessages(langFlag)
+	for domain, entries := range domains {
+		if written[domain] {
+			continue
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].ImportPath < entries[j].ImportPath
+		})
+
+		// An index spread over several pages is searched as a
+		// whole through a separate file listing every entry, as
+		// each page holds only some of them.
+		shards := indexShards(domain, entries, indexSplitFlag, msg.Other)
+		searchIndex := ""
+		if len(shards) > 1 || len(indexPages(entries, indexPageFlag)) > 1 {
+			searchIndex = "/" + searchIndexFile
+			if err := writeSearchIndex(domain+searchIndex, entries); err != nil {
+				return err
+			}
+		}
+
+		// Searches are sent to the root, so the search engine is
+		// only described if the root can search: if it lists the
+		// entries itself, or has the search index.
+		openSearch := len(shards) == 1 || searchIndex != ""
+
+		if len(shards) > 1 {
+			// The root lists only the shards.
+			data := indexData(domain, msg, shards, "", nil)
+			data.SearchIndex, data.OpenSearch = searchIndex, openSearch
+			if err := execute(domain+"/index.html", domainIndexTpl, data); err != nil {
+				return err
+			}
+		}
+
+		// Pages are rendered one at a time, so that no more than
+		// one page is held in memory besides the entries.
+		for _, shard := range shards {
+			pages := indexPages(shard.Entries, indexPageFlag)
+			for i, page := range pages {
+				data := indexData(domain, msg, shards, shard.Key, page)
+				data.SearchIndex, data.OpenSearch = searchIndex, openSearch
+				data.Page, data.Pages = i+1, len(pages)
+				if i > 0 {
+					data.Prev = shard.href(i)
+				}
+				if i+1 < len(pages) {
+					data.Next = shard.href(i + 2)
+				}
+				if err := execute(domain+"/"+shard.name(i+1), domainIndexTpl, data); err != nil {
+					return err
+				}
+			}
+		}
+
+		if openSearch {
+			data := indexData(domain, msg, shards, "", nil)
+			if err := execute(domain+"/opensearch.xml", openSearchTpl, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// domainIndex is the data of a page of a domain index.
+type domainIndex struct {
+	Domain     string
+	Lang       string
+	Msg        messages
+	Private    bool
+	Scheme     string
+	Groups     []indexGroup
+	Script     template.JS
+	Shards     []indexShardLink
+	Page       int
+	Pages      int
+	Prev, Next string
+
+	// SearchIndex, if the index has several pages, is the link to
+	// the file listing every entry, which is searched instead of
+	// those on the page.
+	SearchIndex string
+
+	// OpenSearch is set if the domain's root can be searched, and
+	// so is described for search engines.
+	OpenSearch bool
+}
+
+// searchIndexFile is the name of the file listing every entry of an
+// index that has several pages, at the root of the domain.
+const searchIndexFile = "search.json"
+
+// searchEntry is an entry of a search index.
+type searchEntry struct {
+	Path string `json:"path"`
+	Docs string `json:"docs"`
+}
+
+// writeSearchIndex creates the search index listing entries as the
+// slash-separated file name.
+func writeSearchIndex(name string, entries []indexEntry) (err error) {
+	list := make([]searchEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, searchEntry{Path: e.ImportPath, Docs: e.Docs})
+	}
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return json.NewEncoder(w).Encode(list)
+}
+
+// indexShardLink is a link to a shard of a domain index.
+type indexShardLink struct {
+	Label   string
+	Href    string
+	Count   int
+	Current bool
+}
+
+func indexData(domain string, msg messages, shards []indexShard, current string, entries []indexEntry) domainIndex {
+	d := domainIndex{
+		Domain:  domain,
+		Lang:    langFlag,
+		Msg:     msg,
+		Private: privateFlag,
+		Scheme:  "https",
+		Script:  template.JS(searchScript),
+	}
+	if insecureFlag {
+		d.Scheme = "http"
+	}
+	if entries != nil {
+		d.Groups = groupEntries(entries, msg.Other)
+	}
+	if len(shards) > 1 {
+		for _, s := range shards {
+			d.Shards = append(d.Shards, indexShardLink{
+				Label:   s.Label,
+				Href:    s.href(1),
+				Count:   len(s.Entries),
+				Current: s.Key == current,
+			})
+		}
+	}
+	return d
+}
+
+// indexShard is a part of a domain index, as split by -index-split.
+type indexShard struct {
+	// Key names the shard's pages, or is empty for an index that
+	// is not split.
+	Key     string
+	Label   string
+	Entries []indexEntry
+}
+
+// name returns the name of page n of the shard, counting from 1,
+// relative to the root of the domain. The pages of a split index are
+// kept in a directory named for the shard, as index-<key>/2.html, so
+// that neither a key holding a slash nor one ending in a number can
+// name the page of another shard.
+func (s indexShard) name(n int) string {
+	if s.Key == "" {
+		if n > 1 {
+			return fmt.Sprintf("index-%d.html", n)
+		}
+		return "index.html"
+	}
+	if n > 1 {
+		return fmt.Sprintf("index-%s/%d.html", s.Key, n)
+	}
+	return "index-" + s.Key + "/index.html"
+}
+
+// href returns the link to page n of the shard.
+func (s indexShard) href(n int) string {
+	if n <= 1 {
+		return "/" + strings.TrimSuffix(s.name(n), "index.html")
+	}
+	return "/" + s.name(n)
+}
+
+// indexSplits are the ways -index-split divides a domain index, giving
+// the key and label of the shard holding each entry.
+var indexSplits = map[string]func(domain string, e indexEntry) (key, label string){
+	"letter":     letterShard,
+	"repository": repositoryShard,
+}
+
+// letterShard shards entries by the first letter or digit of their
+// path beneath the domain.
+func letterShard(domain string, e indexEntry) (string, string) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(e.ImportPath, domain), "/")
+	if rest != "" {
+		c := unicode.ToLower(rune(rest[0]))
+		if 'a' <= c && c <= 'z' || '0' <= c && c <= '9' {
+			return string(c), strings.ToUpper(string(c))
+		}
+	}
+	return "", ""
+}
+
+// repositoryShard shards entries by the root of their repository,
+// keyed by its path beneath the domain.
+func repositoryShard(domain string, e indexEntry) (string, string) {
+	root := e.ImportPath
+	if f := strings.Fields(e.VCS.GoImport()); len(f) == 3 {
+		root = f[0]
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(root, domain), "/")
+	if rest == "" {
+		return "", ""
+	}
+	return rest, root
+}
+
+// otherShard is the key of the shard holding entries for which a split
+// has no key. Import paths are not given elements starting with an
+// underscore, as the go command ignores such directories, so it names
+// no other shard.
+const otherShard = "_other"
+
+// indexShards splits entries, sorted by path, by the named split, or
+// returns a single shard if split is empty. Entries for which the split
+// has no key are put in a last shard labelled other.
+func indexShards(domain string, entries []indexEntry, split, other string) []indexShard {
+	shardOf, ok := indexSplits[split]
+	if !ok {
+		return []indexShard{{Entries: entries}}
+	}
+	byKey := make(map[string]*indexShard)
+	var keys []string
+	for _, e := range entries {
+		key, label := shardOf(domain, e)
+		if key == "" {
+			key, label = otherShard, other
+		}
+		s, ok := byKey[key]
+		if !ok {
+			s = &indexShard{Key: key, Label: label}
+			byKey[key] = s
+			keys = append(keys, key)
+		}
+		s.Entries = append(s.Entries, e)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == otherShard) != (keys[j] == otherShard) {
+			return keys[j] == otherShard
+		}
+		return keys[i] < keys[j]
+	})
+	shards := make([]indexShard, 0, len(keys))
+	for _, key := range keys {
+		shards = append(shards, *byKey[key])
+	}
+	return shards
+}
+
+// indexPages splits entries into pages of at most size entries, or a
+// single page if size is not positive.
+func indexPages(entries []indexEntry, size int) [][]indexEntry {
+	if size <= 0 || len(entries) <= size {
+		return [][]indexEntry{entries}
+	}
+	var pages [][]indexEntry
+	for len(entries) > size {
+		pages = append(pages, entries[:size])
+		entries = entries[size:]
+	}
+	return append(pages, entries)
+}
+
+// executor is implemented by both HTML and text templates.
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// execute renders tpl with data into the slash-separated file name
+// beneath the output directory.
+func execute(name string, tpl executor, data interface{}) (err error) {
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	return tpl.Execute(w, data)
+}
+
+// searchScript filters the entries on a domain index, or for an index
+// with several pages lists those in its search index in place of the
+// page. It is kept separately so that its hash can be allowed by a
+// security policy.
+const searchScript = `
+(function() {
+	var search = document.getElementById("search");
+	var items = document.querySelectorAll(".packages li");
+	var index = search.getAttribute("data-index");
+	var entries = null;
+	function show(q) {
+		var results = document.getElementById("results");
+		results.textContent = "";
+		results.hidden = !q;
+		document.getElementById("page").hidden = !!q;
+		for (var i = 0; q && i < entries.length; i++) {
+			if (entries[i].path.toLowerCase().indexOf(q) < 0) continue;
+			var a = document.createElement("a");
+			a.href = entries[i].docs;
+			a.textContent = entries[i].path;
+			results.appendChild(document.createElement("li")).appendChild(a);
+		}
+	}
+	function filter() {
+		var q = search.value.toLowerCase();
+		if (index) {
+			if (entries) {
+				show(q);
+			} else if (q) {
+				fetch(index).then(function(r) { return r.json(); }).then(function(e) {
+					entries = e;
+					filter();
+				});
+			}
+			return;
+		}
+		for (var i = 0; i < items.length; i++) {
+			var path = items[i].getAttribute("data-path").toLowerCase();
+			items[i].hidden = path.indexOf(q) < 0;
+		}
+	}
+	search.value = new URLSearchParams(location.search).get("q") || "";
+	search.addEventListener("input", filter);
+	filter();
+})();
+`
+
+var domainIndexTpl = template.Must(template.New("domain").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Domain }}</title>
+{{- if .OpenSearch }}
+<link rel="search" type="application/opensearchdescription+xml" href="/opensearch.xml" title="{{ .Domain }}">
+{{- end }}
+</head>
+<body>
+<h1>{{ .Domain }}</h1>
+{{- if .Private }}
+<p>{{ .Msg.PrivateDomain }}</p>
+<pre>go env -w GOPRIVATE={{ .Domain }}</pre>
+{{- end }}
+{{- with .Shards }}
+<nav class="shards">
+{{- range . }}
+{{- if .Current }}
+<strong>{{ .Label }}</strong>
+{{- else }}
+<a href="{{ .Href }}">{{ .Label }}</a>
+{{- end }} ({{ .Count }})
+{{- end }}
+</nav>
+{{- end }}
+{{- if or .Groups .SearchIndex }}
+<input id="search" type="search" placeholder="{{ .Msg.Search }}" aria-label="{{ printf .Msg.SearchDomain .Domain }}"{{ with .SearchIndex }} data-index="{{ . }}"{{ end }} autofocus>
+{{- end }}
+{{- if .SearchIndex }}
+<ul id="results" hidden></ul>
+{{- end }}
+<div id="page">
+{{- range .Groups }}
+{{- if .Name }}
+<h2>{{ .Name }} ({{ len .Entries }})</h2>
+{{- end }}
+<ul class="packages">
+{{- range .Entries }}
+<li data-path="{{ .ImportPath }}"><a href="{{ .Docs }}">{{ .ImportPath }}</a> (<a href="{{ $.Scheme }}://{{ .Repository }}" aria-label="{{ printf $.Msg.SourceOf .ImportPath }}">{{ $.Msg.Source }}</a>){{ with .Module }}{{ with .Go }} {{ printf $.Msg.GoVersion . }}{{ end }}{{ end }}{{ with .Stats }} {{ printf $.Msg.Stats .Packages .Dependencies }}{{ end }}</li>
+{{- end }}
+</ul>
+{{- end }}
+{{- if gt .Pages 1 }}
+<nav>
+{{- with .Prev }}
+<a href="{{ . }}" rel="prev">{{ $.Msg.Previous }}</a>
+{{- end }}
+<span>{{ printf .Msg.PageOf .Page .Pages }}</span>
+{{- with .Next }}
+<a href="{{ . }}" rel="next">{{ $.Msg.Next }}</a>
+{{- end }}
+</nav>
+{{- end }}
+</div>
+{{- if or .Groups .SearchIndex }}
+<script>{{ .Script }}</script>
+{{- end }}
+</body>
+</html>
+`))
+
+// openSearchTpl is XML, so it is escaped explicitly rather than by
+// html/template.
+var openSearchTpl = texttemplate.Must(texttemplate.New("opensearch").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+<ShortName>{{ html .Domain }}</ShortName>
+<Description>Search Go packages on {{ html .Domain }}</Description>
+<InputEncoding>UTF-8</InputEncoding>
+<Url type="text/html" template="{{ .Scheme }}://{{ html .Domain }}/?q={searchTerms}"/>
+</OpenSearchDescription>
+`))
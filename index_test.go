@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// BenchmarkWriteIndexes measures generating the paginated index of a
+// domain with many paths.
+func BenchmarkWriteIndexes(b *testing.B) {
+	var entries []indexEntry
+	for i := 0; i < 5000; i++ {
+		repo := fmt.Sprintf("github.com/actual-user/repo%d", i/10)
+		importPath := fmt.Sprintf("vanity.example.com/repo%d/pkg%d", i/10, i%10)
+		vcs, err := newProvider(Repo{ImportPath: importPath, Repository: repo})
+		if err != nil {
+			b.Fatal(err)
+		}
+		entries = append(entries, indexEntry{ImportPath: importPath, Docs: docsURL(importPath), Repository: repo, VCS: vcs})
+	}
+
+	defer func(d destination) { dest = d }(dest)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dest = make(memDestination)
+		if err := writeIndexes(entries, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// roundTripFunc answers HTTP requests with a function.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestFetchTopicsWrapped(t *testing.T) {
+	defer func(rt http.RoundTripper) { apiClient.Transport = rt }(apiClient.Transport)
+	apiClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.URL.String() != "https://api.github.com/repos/actual-user/foo/topics" {
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"names":["cli"]}`)),
+			Request:    r,
+		}, nil
+	})
+
+	r := Repo{ImportPath: "vanity.example.com/foo", Repository: "github.com/actual-user/foo"}
+	var vcs Provider = GitHub{r}
+	vcs = sourceOverride{Provider: vcs}
+	vcs = sshProvider{vcs}
+	vcs = insecureProvider{vcs}
+	vcs = prefixOverride{Provider: vcs, old: "vanity.example.com", new: "old.example.com"}
+	vcs = vcsOverride{Provider: vcs, vcs: "git"}
+
+	entries := []indexEntry{{ImportPath: r.ImportPath, Repository: r.Repository, Tags: []string{"tools"}, VCS: vcs}}
+	if err := fetchTopics(entries); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(entries[0].Tags, " "), "tools cli"; got != want {
+		t.Errorf("tags %q, want %q", got, want)
+	}
+}
+
+func TestWriteIndexesShardNames(t *testing.T) {
+	defer func(d destination, split string, size int) {
+		dest, indexSplitFlag, indexPageFlag = d, split, size
+	}(dest, indexSplitFlag, indexPageFlag)
+	mem := make(memDestination)
+	dest, indexSplitFlag, indexPageFlag = mem, "repository", 1
+
+	// Each shard's pages must have names of their own, even where
+	// one repository's path is that of another's page, or the
+	// repository is named for the shard of the domain's own paths.
+	var entries []indexEntry
+	for _, p := range []struct{ root, importPath string }{
+		{"vanity.example.com/a", "vanity.example.com/a"},
+		{"vanity.example.com/a", "vanity.example.com/a/b"},
+		{"vanity.example.com/a/2", "vanity.example.com/a/2"},
+		{"vanity.example.com/other", "vanity.example.com/other"},
+		{"vanity.example.com", "vanity.example.com/x"},
+	} {
+		vcs, err := newProvider(Repo{ImportPath: p.root, Repository: "github.com/actual-user/repo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, indexEntry{ImportPath: p.importPath, Docs: docsURL(p.importPath), Repository: "github.com/actual-user/repo", VCS: vcs})
+	}
+	if err := writeIndexes(entries, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{
+		"index.html",
+		"index-a/index.html",
+		"index-a/2.html",
+		"index-a/2/index.html",
+		"index-other/index.html",
+		"index-_other/index.html",
+	} {
+		if _, ok := mem["vanity.example.com/"+name]; !ok {
+			t.Errorf("%s not written", name)
+		}
+	}
+	for _, link := range []string{`href="/index-a/"`, `href="/index-a/2/"`, `href="/index-other/"`, `href="/index-_other/"`} {
+		if !strings.Contains(mem["vanity.example.com/index.html"].String(), link) {
+			t.Errorf("root index lacks %s", link)
+		}
+	}
+}
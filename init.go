@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// initMain implements the init command, which asks for the vanity
+// domain, where its repositories are hosted and where pages are to be
+// written, checks the page for a sample repository, and writes a
+// starter configuration file.
+func initMain(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.Usage = usage
+	name := fs.String("config", "vanity.json", "configuration file to write")
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for the sample repository to respond")
+	fs.Parse(args)
+
+	in := bufio.NewScanner(os.Stdin)
+	ask := func(prompt, def string) string {
+		if def != "" {
+			prompt += " [" + def + "]"
+		}
+		fmt.Fprintf(os.Stderr, "%s: ", prompt)
+		if !in.Scan() {
+			if def == "" {
+				exitOnErr(fmt.Errorf("init: %s: no answer", prompt), exitUsage)
+			}
+			fmt.Fprintln(os.Stderr)
+			return def
+		}
+		if answer := strings.TrimSpace(in.Text()); answer != "" {
+			return answer
+		}
+		return def
+	}
+
+	domain, err := asciiDomain(ask("Vanity domain, such as go.example.com", ""))
+	exitOnErr(err, exitUsage)
+	exitOnErr(checkImportPath(domain), exitUsage)
+
+	hosting := strings.Trim(ask("Where its repositories are hosted, such as github.com/actual-user", ""), "/")
+	exitOnErr(checkImportPath(hosting), exitUsage)
+
+	replace := domain + "=" + hosting
+	pc := PathConfig{Replace: new(replacerValue)}
+	err = pc.Replace.Set(replace)
+	exitOnErr(err, exitUsage)
+	host, _, _ := strings.Cut(hosting, "/")
+	if probe, _ := hostProvider(Repo{Repository: host}); probe != nil {
+		if _, ok := probe.(GitHub); ok && host != "github.com" {
+			pc.Provider = ask("Software serving the repositories: github, gitlab, cgit, gitweb or launchpad", "github")
+		}
+	}
+	exitOnErr(pc.HostConfig.validate(), exitUsage)
+
+	out := ask("Output directory", "out")
+
+	config = Config{
+		Allow: []string{domain},
+		Paths: map[string]PathConfig{domain: pc},
+	}
+
+	if sample := ask("Name of a repository to check, such as foo, or - to skip", "-"); sample != "-" {
+		problems, err := checkSample(domain+"/"+sample, *timeout)
+		exitOnErr(err, exitError)
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s/%s: %s\n", domain, sample, p)
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(os.Stderr, "%s/%s: ok\n", domain, sample)
+		} else if ask("Write the configuration anyway? (y/n)", "n") != "y" {
+			os.Exit(exitFindings)
+		}
+	}
+
+	if _, err := os.Stat(*name); err == nil && ask(*name+" exists. Replace it? (y/n)", "n") != "y" {
+		os.Exit(exitUsage)
+	}
+	err = writeStarterConfig(*name, domain, replace, pc.Provider)
+	exitOnErr(err, exitOutput)
+
+	fmt.Fprintf(os.Stderr, "\nWrote %s. Generate the pages with:\n\n", *name)
+	fmt.Fprintf(os.Stderr, "\tgo list %s/... | vanity -config %s -o %s\n", domain, *name, out)
+}
+
+// checkSample renders the page for importPath in memory, and returns
+// the problems that would stop go get from fetching it: problems with
+// the page itself, or a repository that cannot be reached.
+func checkSample(importPath string, timeout time.Duration) ([]string, error) {
+	r := Repo{ImportPath: importPath, Repository: config.repository(importPath)}
+	vcs, err := newProvider(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	p := page{ImportPath: importPath, Docs: docsURL(importPath), VCS: vcs}
+	if err := renderPage(&buf, indexTpl, p); err != nil {
+		return nil, err
+	}
+	problems := validateHTML(buf.Bytes())
+
+	if f := strings.Fields(vcs.GoImport()); len(f) == 3 {
+		if err := checkRepository(f[1], f[2], timeout); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f[2], err))
+		}
+	}
+	return problems, nil
+}
+
+// writeStarterConfig writes a configuration file name allowing only
+// paths on domain, whose repositories are found by the -replace pairs
+// replace on the given provider, if set.
+func writeStarterConfig(name, domain, replace, provider string) error {
+	type pathConfig struct {
+		Replace  string `json:"replace"`
+		Provider string `json:"provider,omitempty"`
+	}
+	c := struct {
+		Allow []string              `json:"allow"`
+		Paths map[string]pathConfig `json:"paths"`
+	}{
+		Allow: []string{domain},
+		Paths: map[string]pathConfig{
+			domain: {Replace: replace, Provider: provider},
+		},
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(c)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
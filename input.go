@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Input is a document read by the -json flag, describing each package
+// explicitly rather than finding it in the GOPATH. It is the most
+// explicit way to generate pages, for pipelines that already know
+// where each package is kept:
+//
+//	{
+//	  "packages": [
+//	    {
+//	      "importPath": "vanity.example.com/foo/bar",
+//	      "root": "vanity.example.com/foo",
+//	      "repository": "github.com/actual-user/foo",
+//	      "vcs": "git",
+//	      "branch": "main",
+//	      "docs": "https://pkg.go.dev/vanity.example.com/foo/bar",
+//	      "display": {"name": "Bar"}
+//	    }
+//	  ]
+//	}
+type Input struct {
+	Packages []InputPackage `json:"packages"`
+}
+
+// InputPackage describes a single package in an Input document. Only
+// ImportPath and Repository are required.
+type InputPackage struct {
+	ImportPath string `json:"importPath"`
+
+	// Root is the import path of the repository holding the
+	// package, if it is not ImportPath itself.
+	Root string `json:"root"`
+
+	// Repository is the host and path of the repository, such as
+	// "github.com/actual-user/foo". It is used as given, without
+	// any -replace rules applied.
+	Repository string `json:"repository"`
+
+	// Dir is the slash-separated path of the package's module
+	// within the repository, or empty if the module is at the root.
+	Dir string `json:"dir"`
+
+	// VCS, if set, overrides the version control system named in
+	// the go-import meta tag.
+	VCS string `json:"vcs"`
+
+	// Branch is the branch that source links refer to.
+	Branch string `json:"branch"` // default "master"
+
+	// Docs is the URL browsers are redirected to.
+	Docs string `json:"docs"` // default godoc.org
+
+	// GoVersion is the minimum version of Go the module requires.
+	GoVersion string `json:"goVersion"`
+
+	// Display, if set, is used instead of the display settings in
+	// the configuration file.
+	Display *Display `json:"display"`
+}
+
+// loadInput reads an Input document from name, or standard input if
+// name is "-".
+func loadInput(name string) (Input, error) {
+	var in Input
+
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return in, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return in, fmt.Errorf("%s: %v", name, err)
+	}
+
+	for i, p := range in.Packages {
+		// Internationalized domains are given in their punycode
+		// form, as import paths must be ASCII.
+		for _, s := range []*string{&p.ImportPath, &p.Root, &p.Repository} {
+			var err error
+			if *s, err = asciiDomain(*s); err != nil {
+				return in, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		in.Packages[i] = p
+
+		switch {
+		case p.ImportPath == "":
+			return in, fmt.Errorf("%s: package %d: missing importPath", name, i)
+		case checkImportPath(p.ImportPath) != nil:
+			return in, fmt.Errorf("%s: %w", name, checkImportPath(p.ImportPath))
+		case p.Root != "" && checkImportPath(p.Root) != nil:
+			return in, fmt.Errorf("%s: %w", name, checkImportPath(p.Root))
+		case p.Repository == "":
+			return in, fmt.Errorf("%s: %s: missing repository", name, p.ImportPath)
+		case p.VCS != "" && !knownVCS[p.VCS]:
+			return in, fmt.Errorf("%s: %s: unknown vcs %q", name, p.ImportPath, p.VCS)
+		}
+	}
+	return in, nil
+}
+
+// repoInputs describes the repositories in the comma-separated list,
+// as given to -repos, at the import paths that -replace maps to them.
+func repoInputs(list string) ([]InputPackage, error) {
+	var pkgs []InputPackage
+	for _, repo := range strings.Split(list, ",") {
+		repo = strings.TrimSpace(repo)
+		if repo == "" {
+			continue
+		}
+		importPath, ok := replacerFlag.importPath(repo)
+		if !ok {
+			return nil, fmt.Errorf("-repos: no -replace pair maps an import path to %s", repo)
+		}
+		if err := checkImportPath(importPath); err != nil {
+			return nil, fmt.Errorf("-repos: %w", err)
+		}
+		pkgs = append(pkgs, InputPackage{ImportPath: importPath, Repository: repo})
+	}
+	return pkgs, nil
+}
+
+// resolveInput returns the page for a package described by an Input
+// document.
+func resolveInput(p InputPackage) (pending, error) {
+	root := p.Root
+	if root == "" {
+		root = p.ImportPath
+	}
+	stats.addPackage(root)
+	if err := forced(checkReplaced(root, p.Repository)); err != nil {
+		return pending{}, err
+	}
+
+	repo := Repo{
+		ImportPath: root,
+		Repository: p.Repository,
+		Dir:        p.Dir,
+		Branch:     p.Branch,
+	}
+	if config.mirrored(root) {
+		repo.Repository = config.repository(root)
+	}
+	vcs, err := newProvider(repo)
+	if err != nil {
+		return pending{}, err
+	}
+	if p.VCS != "" {
+		vcs = vcsOverride{Provider: vcs, vcs: p.VCS}
+	}
+
+	display := config.Lookup(p.ImportPath).Display
+	if p.Display != nil {
+		display = *p.Display
+	}
+	docs := p.Docs
+	if docs == "" {
+		docs = docsURL(p.ImportPath)
+	}
+
+	return pending{
+		page: page{
+			ImportPath: p.ImportPath,
+			Display:    display,
+			Module:     &goMod{Go: p.GoVersion},
+			Docs:       docs,
+			VCS:        vcs,
+		},
+		repo: repo,
+	}, nil
+}
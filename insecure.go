@@ -0,0 +1,34 @@
+package main
+
+import "strings"
+
+// insecureWarning is printed whenever -insecure is used, as pages for
+// a production vanity domain must never be served this way.
+const insecureWarning = `warning: -insecure generates pages referring to repositories and
+documentation over plain HTTP, for environments such as air-gapped labs
+that cannot serve HTTPS. The go command fetches them only for modules
+matched by GOINSECURE, and production vanity domains must use HTTPS.`
+
+// warnInsecure prints insecureWarning to standard error if -insecure
+// is set.
+func warnInsecure() {
+	if insecureFlag {
+		stats.warn()
+		logf("%s\n", insecureWarning)
+	}
+}
+
+// insecureURLs replaces each https URL in s with http.
+func insecureURLs(s string) string {
+	return strings.ReplaceAll(s, "https://", "http://")
+}
+
+// insecureProvider refers to a Provider's repositories over HTTP.
+type insecureProvider struct {
+	Provider
+}
+
+func (p insecureProvider) GoImport() string { return insecureURLs(p.Provider.GoImport()) }
+func (p insecureProvider) GoSource() string { return insecureURLs(p.Provider.GoSource()) }
+func (p insecureProvider) Releases() string { return insecureURLs(p.Provider.Releases()) }
+func (p insecureProvider) unwrap() Provider { return p.Provider }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// kubeName is the name of each Kubernetes object written by -kubernetes.
+const kubeName = "vanity"
+
+// kubeConfigMapLimit is the most data a ConfigMap may hold.
+const kubeConfigMapLimit = 1 << 20
+
+// kubeObject is a Kubernetes object, as read by "kubectl apply".
+type kubeObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Data       map[string]string `json:"data,omitempty"`
+	BinaryData map[string][]byte `json:"binaryData,omitempty"`
+	Spec       any               `json:"spec,omitempty"`
+}
+
+func newKubeObject(apiVersion, kind string) *kubeObject {
+	o := &kubeObject{APIVersion: apiVersion, Kind: kind}
+	o.Metadata.Name = kubeName
+	o.Metadata.Labels = map[string]string{"app.kubernetes.io/name": kubeName}
+	return o
+}
+
+// writeKubernetes creates the Kubernetes manifests name in the output
+// directory, serving every other file written from within a cluster: a
+// ConfigMap holding the files and the configuration of nginx, and the
+// Deployment, Service and Ingress for nginx serving them at each domain
+// with written pages. The manifests are YAML documents, each written as
+// JSON, for kubectl apply or a GitOps tool.
+func writeKubernetes(k *kvDestination, name string, written map[string]bool) (err error) {
+	cm := newKubeObject("v1", "ConfigMap")
+	cm.Data = map[string]string{"default.conf": kubeNginxConf()}
+	cm.BinaryData = make(map[string][]byte)
+
+	// Keys in a ConfigMap cannot hold slashes, so each file is given
+	// a key of its own and mounted at its name.
+	var items []map[string]string
+	size := len(cm.Data["default.conf"])
+	for i, n := range k.names() {
+		if n == name || n == kvFlag || !strings.Contains(n, "/") {
+			continue
+		}
+		b := k.files[n].Bytes()
+		key := fmt.Sprintf("file-%d", i)
+		if utf8.Valid(b) {
+			cm.Data[key] = string(b)
+		} else {
+			cm.BinaryData[key] = b
+		}
+		items = append(items, map[string]string{"key": key, "path": n})
+		size += len(b)
+	}
+	if size > kubeConfigMapLimit {
+		warnf("%s: the ConfigMap holds %d bytes, more than the %d Kubernetes allows\n", name, size, kubeConfigMapLimit)
+	}
+
+	labels := map[string]string{"app.kubernetes.io/name": kubeName}
+
+	deploy := newKubeObject("apps/v1", "Deployment")
+	deploy.Spec = map[string]any{
+		"replicas": 2,
+		"selector": map[string]any{"matchLabels": labels},
+		"template": map[string]any{
+			"metadata": map[string]any{"labels": labels},
+			"spec": map[string]any{
+				"containers": []map[string]any{{
+					"name":  "nginx",
+					"image": "nginxinc/nginx-unprivileged:stable-alpine",
+					"ports": []map[string]any{{"name": "http", "containerPort": 8080}},
+					"volumeMounts": []map[string]any{
+						{"name": "pages", "mountPath": "/srv/vanity", "readOnly": true},
+						{"name": "conf", "mountPath": "/etc/nginx/conf.d", "readOnly": true},
+					},
+					"readinessProbe": map[string]any{
+						"httpGet": map[string]any{"path": "/healthz", "port": "http"},
+					},
+				}},
+				"volumes": []map[string]any{
+					{"name": "pages", "configMap": map[string]any{"name": kubeName, "items": items}},
+					{"name": "conf", "configMap": map[string]any{"name": kubeName, "items": []map[string]string{
+						{"key": "default.conf", "path": "default.conf"},
+					}}},
+				},
+			},
+		},
+	}
+
+	svc := newKubeObject("v1", "Service")
+	svc.Spec = map[string]any{
+		"selector": labels,
+		"ports":    []map[string]any{{"name": "http", "port": 80, "targetPort": "http"}},
+	}
+
+	var rules []map[string]any
+	hosts := domains(written)
+	for _, domain := range hosts {
+		rules = append(rules, map[string]any{
+			"host": domain,
+			"http": map[string]any{"paths": []map[string]any{{
+				"path":     "/",
+				"pathType": "Prefix",
+				"backend": map[string]any{"service": map[string]any{
+					"name": kubeName,
+					"port": map[string]any{"name": "http"},
+				}},
+			}}},
+		})
+	}
+	ingress := newKubeObject("networking.k8s.io/v1", "Ingress")
+	spec := map[string]any{"rules": rules}
+	if !insecureFlag {
+		// The go command fetches pages only over HTTPS.
+		spec["tls"] = []map[string]any{{"hosts": hosts, "secretName": kubeName + "-tls"}}
+	}
+	ingress.Spec = spec
+
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for i, o := range []*kubeObject{cm, deploy, svc, ingress} {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w, "---"); err != nil {
+				return err
+			}
+		}
+		b, err := json.MarshalIndent(o, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kubeNginxConf returns the configuration of nginx serving the files
+// of each domain from its directory, as a static host would, with the
+// same headers as -headers.
+func kubeNginxConf() string {
+	var b strings.Builder
+	b.WriteString("server {\n")
+	b.WriteString("\tlisten 8080;\n")
+	b.WriteString("\troot /srv/vanity/$host;\n")
+	b.WriteString("\tdefault_type text/html;\n")
+	// Pages, and the text files written beside them, are UTF-8.
+	b.WriteString("\tcharset utf-8;\n")
+	b.WriteString("\tcharset_types text/plain text/xml text/css application/json application/xml image/svg+xml;\n")
+	for _, h := range securityHeaders() {
+		fmt.Fprintf(&b, "\tadd_header %s %q always;\n", h[0], h[1])
+	}
+	b.WriteString("\n\tlocation / {\n")
+	b.WriteString("\t\ttry_files $uri $uri/index.html =404;\n")
+	b.WriteString("\t}\n")
+	b.WriteString("\n\tlocation = /healthz {\n")
+	b.WriteString("\t\treturn 200;\n")
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+)
+
+// kvEntry is an entry in a key-value export, in the format read by
+// "consul kv import". The value is encoded in base64.
+type kvEntry struct {
+	Key   string `json:"key"`
+	Flags int    `json:"flags"`
+	Value []byte `json:"value"`
+}
+
+// kvDestination keeps a copy of each file created in its destination,
+// so that they can be exported with -kv or -kubernetes.
+type kvDestination struct {
+	destination
+	files map[string]*bytes.Buffer
+}
+
+func (k *kvDestination) Create(name string) (io.WriteCloser, error) {
+	w, err := k.destination.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	k.files[name] = buf
+	return multiWriteCloser{w, NopCloser(buf)}, nil
+}
+
+// names returns the names of the files created, in order.
+func (k *kvDestination) names() []string {
+	names := make([]string, 0, len(k.files))
+	for n := range k.files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeKV creates the key-value export name, holding every other file
+// in the output keyed by its slash-separated name. Hosts that serve
+// files only from a store such as Consul or etcd can load it:
+//
+//	consul kv import -prefix=vanity/ @out/kv.json
+//
+// The preview command serves such an export with -kv.
+func writeKV(k *kvDestination, name string) (err error) {
+	entries := make([]kvEntry, 0, len(k.files))
+	for _, n := range k.names() {
+		if n == name {
+			continue
+		}
+		entries = append(entries, kvEntry{Key: n, Value: k.files[n].Bytes()})
+	}
+
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// readKV reads the files in the key-value export name into memory.
+func readKV(name string) (memHandler, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var entries []kvEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	files := make(memDestination)
+	for _, e := range entries {
+		files[e.Key] = bytes.NewBuffer(e.Value)
+	}
+	return memHandler(files), nil
+}
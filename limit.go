@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// limiterIdle is how long a client's rate limit is remembered after
+// its last request.
+const limiterIdle = 10 * time.Minute
+
+// limiter restricts the requests made to a handler, by user agent and
+// by the rate at which each client address makes them.
+type limiter struct {
+	rate  float64 // requests per second per client; 0 is unlimited
+	burst float64
+
+	allow *regexp.Regexp // agents exempt from all limits
+	deny  *regexp.Regexp // agents refused
+
+	trusted []*net.IPNet // proxies whose X-Forwarded-For is believed
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// bucket holds the tokens available to a single client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limit returns a handler that answers requests with h unless they
+// exceed the limits.
+func (l *limiter) limit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent := r.UserAgent()
+		if l.allow != nil && l.allow.MatchString(agent) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if l.deny != nil && l.deny.MatchString(agent) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if l.rate > 0 && !l.take(l.clientAddr(r), time.Now()) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// take reports whether the client at addr may make a request at now,
+// using one of its tokens if so.
+func (l *limiter) take(addr string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+
+	// Forget idle clients, so memory is not held for every address
+	// ever seen.
+	if now.Sub(l.lastPrune) > limiterIdle {
+		for addr, b := range l.buckets {
+			if now.Sub(b.last) > limiterIdle {
+				delete(l.buckets, addr)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	b, ok := l.buckets[addr]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[addr] = b
+	}
+
+	// Refill tokens for the time elapsed since the last request.
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// clientAddr returns the IP address of the client making r. A request
+// from a trusted proxy is made by the last address its X-Forwarded-For
+// header lists that is not itself a trusted proxy, as the addresses
+// before it may be forged by the client.
+func (l *limiter) clientAddr(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if !l.isTrusted(addr) {
+		return addr
+	}
+
+	var forwarded []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(v, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr = strings.TrimSpace(forwarded[i])
+		if !l.isTrusted(addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// isTrusted reports whether addr is the IP address of a trusted proxy.
+func (l *limiter) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range l.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a comma-separated list of IP addresses and
+// CIDR ranges.
+func parseTrustedProxies(str string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: expected an IP address or CIDR range", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: expected an IP address or CIDR range", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
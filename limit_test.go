@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddr(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &limiter{trusted: trusted}
+
+	tests := []struct {
+		remote, forwarded, want string
+	}{
+		{"203.0.113.5:1234", "", "203.0.113.5"},
+		// Only trusted proxies are believed.
+		{"203.0.113.5:1234", "198.51.100.7", "203.0.113.5"},
+		{"192.0.2.1:1234", "198.51.100.7", "198.51.100.7"},
+		// The client may forge the start of the header, but not what
+		// the trusted proxies append.
+		{"10.1.2.3:1234", "1.1.1.1, 198.51.100.7, 10.9.9.9", "198.51.100.7"},
+		{"10.1.2.3:1234", "10.9.9.9", "10.9.9.9"},
+		{"10.1.2.3:1234", "", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := l.clientAddr(r); got != tt.want {
+			t.Errorf("clientAddr(%s, X-Forwarded-For %q) = %s, want %s", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+
+	if _, err := parseTrustedProxies("proxy.example.com"); err == nil {
+		t.Error("parseTrustedProxies accepted a host name")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// knownVCS are the version control systems named in go-import meta
+// tags that the go command understands.
+var knownVCS = map[string]bool{
+	"bzr":    true,
+	"fossil": true,
+	"git":    true,
+	"hg":     true,
+	"mod":    true,
+	"svn":    true,
+}
+
+// lintMain implements the lint command, which reports pages that the go
+// command would reject or misread.
+func lintMain(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = usage
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var problems int
+	for _, root := range paths {
+		err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(name) != ".html" {
+				return err
+			}
+
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			for _, p := range lintPage(f) {
+				fmt.Printf("%s: %s\n", name, p)
+				problems++
+			}
+			return nil
+		})
+		exitOnErr(err, exitError)
+	}
+
+	if problems > 0 {
+		os.Exit(exitFindings)
+	}
+}
+
+// lintPage describes the problems the go command would have reading the
+// meta tags of the page read from r.
+//
+// The page is parsed as the go command parses it: as lenient XML, only
+// up to the start of the body or end of the head, and only in UTF-8.
+func lintPage(r io.Reader) []string {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "ascii":
+			return input, nil
+		default:
+			return nil, fmt.Errorf("can't decode XML document using charset %q", charset)
+		}
+	}
+
+	var (
+		problems []string
+		imports  int
+		sources  int
+		prefixes = make(map[string]bool)
+		ended    string // element that ended the go command's reading
+		declared bool   // whether the charset is declared
+	)
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err != io.EOF && ended == "" {
+				problems = append(problems, fmt.Sprintf("parse error: %v", err))
+			}
+			break
+		}
+
+		if ended == "" {
+			switch e := t.(type) {
+			case xml.StartElement:
+				if strings.EqualFold(e.Name.Local, "body") {
+					ended = "<body>"
+				}
+			case xml.EndElement:
+				if strings.EqualFold(e.Name.Local, "head") {
+					ended = "</head>"
+				}
+			}
+		}
+
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+
+		name := attrValue(e.Attr, "name")
+		content := attrValue(e.Attr, "content")
+		if charset := attrValue(e.Attr, "charset"); charset != "" {
+			declared = true
+			if !strings.EqualFold(charset, "utf-8") {
+				problems = append(problems, fmt.Sprintf("charset %q is not UTF-8", charset))
+			}
+			continue
+		}
+		if name == "" && strings.EqualFold(attrValue(e.Attr, "http-equiv"), "content-type") {
+			declared = true
+			if !isHTMLType(content) {
+				problems = append(problems, fmt.Sprintf("content type %q is not %q", content, htmlType))
+			}
+			continue
+		}
+		if name != "go-import" && name != "go-source" {
+			continue
+		}
+		if ended != "" {
+			problems = append(problems, fmt.Sprintf("%s meta tag after %s is ignored", name, ended))
+			continue
+		}
+
+		f := strings.Fields(content)
+		switch name {
+		case "go-import":
+			imports++
+			if len(f) != 3 && len(f) != 4 {
+				problems = append(problems, fmt.Sprintf("go-import content %q has %d fields, want 3 or 4", content, len(f)))
+				continue
+			}
+			if prefixes[f[0]] {
+				problems = append(problems, fmt.Sprintf("duplicate go-import for prefix %q", f[0]))
+			}
+			prefixes[f[0]] = true
+			if !knownVCS[f[1]] {
+				problems = append(problems, fmt.Sprintf("go-import has unknown VCS %q", f[1]))
+			}
+			if !strings.Contains(f[2], "://") {
+				problems = append(problems, fmt.Sprintf("go-import repository %q has no scheme", f[2]))
+			}
+		case "go-source":
+			sources++
+			if len(f) != 4 {
+				problems = append(problems, fmt.Sprintf("go-source content %q has %d fields, want 4", content, len(f)))
+			}
+		}
+	}
+
+	// Pages without any tags, such as an index, are not for the go
+	// command at all.
+	if imports == 0 && sources > 0 {
+		problems = append(problems, "go-source meta tag without go-import")
+	}
+	if !declared {
+		problems = append(problems, "charset is not declared, so browsers may not read the page as UTF-8")
+	}
+	return problems
+}
+
+// isHTMLType reports whether the content type ctype is HTML in UTF-8.
+func isHTMLType(ctype string) bool {
+	mediaType, params, err := mime.ParseMediaType(ctype)
+	return err == nil && mediaType == "text/html" && strings.EqualFold(params["charset"], "utf-8")
+}
+
+// attrValue returns the value of the named attribute, or an empty
+// string if there is none. Attribute names are compared case
+// insensitively, as they are by the go command.
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// findLoops returns a description of each entry whose go-import meta
+// tag sends the go command back to one of the written vanity domains,
+// or to a host aliased to them, from which it would be sent back again.
+// Module proxies are exempt, as the go command does not look up import
+// paths beneath them.
+func findLoops(entries []indexEntry, written map[string]bool) []string {
+	hosts := make(map[string]bool)
+	for _, domain := range domains(written) {
+		hosts[domain] = true
+	}
+	for alias := range config.Aliases {
+		hosts[strings.ToLower(alias)] = true
+	}
+
+	var loops []string
+	for _, e := range entries {
+		f := strings.Fields(e.VCS.GoImport())
+		if len(f) < 3 || f[1] == "mod" {
+			continue
+		}
+		u, err := url.Parse(f[2])
+		if err != nil || !hosts[strings.ToLower(u.Hostname())] {
+			continue
+		}
+		loops = append(loops, fmt.Sprintf("%s: go-import repository %s is served by the vanity domains", e.ImportPath, f[2]))
+	}
+	return loops
+}
+
+// checkLoops fails the run, or with -force warns, if any entry's
+// go-import meta tag loops back to the vanity domains.
+func checkLoops(entries []indexEntry, written map[string]bool) {
+	loops := findLoops(entries, written)
+	for _, loop := range loops {
+		logf("%s\n", loop)
+	}
+	if len(loops) > 0 {
+		checkOrWarn(fmt.Errorf("%d import paths would send go get back to the vanity domains", len(loops)), exitLoad)
+	}
+}
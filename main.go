@@ -11,115 +11,1245 @@ GitHub user:
 
 	go list vanity.example.com/... | \
 	  vanity -replace vanity.example.com=github.com/actual-user -o .
+
+Getting started
+
+The init command asks for the vanity domain, where its repositories
+are hosted and where pages are to be written, checks the page for a
+sample repository, and writes a starter configuration:
+
+	vanity init -config vanity.json
+
+The doctor command checks the environment for what vanity needs, such
+as git and GOPATH, and the tokens used with provider APIs. It checks
+that each vanity domain resolves, serves HTTPS with a valid
+certificate, and serves the page for a module to the go command
+without redirecting to HTTP. It also checks that proxy.golang.org can
+resolve the module. The module is the first generated on the domain
+from the input named by -json, -repos, -dir or -f, or else the first
+path configured beneath it; without either, these checks are skipped
+with a warning. It prints how to fix each problem:
+
+	vanity doctor -config vanity.json -json packages.json
+
+Pages for the go command
+
+With -go-get-page, a second page carrying only the meta tags read by
+the go command is written beside each landing page. Hosts that can
+route on the "go-get=1" query parameter may serve it to the go command
+while browsers receive the full page. Either page may be replaced
+using -template and -go-get-template. A template defining only some
+of the landing page's blocks, "head", "meta", "body" and "footer",
+replaces just those:
+
+	{{ define "footer" }}<p>Maintained by Example Corp.</p>{{ end }}
+
+Hosts without directory indexes
+
+Object stores such as S3 behind CloudFront serve /path only from an
+object named exactly "path". As such an object would share its name
+with the directory holding path/index.html, -clean-urls lists the
+copies to make once the pages are uploaded:
+
+	vanity -o out -clean-urls clean-urls.txt ... &&
+	aws s3 sync out s3://bucket &&
+	while read page key; do
+	  aws s3 cp "s3://bucket/$page" "s3://bucket/$key" \
+	    --content-type "text/html; charset=utf-8" --metadata-directive REPLACE
+	done < out/clean-urls.txt
+
+Rather than a directory, -o may name a URL: file:///srv/www for a
+directory, s3://bucket/prefix or gs://bucket/prefix to upload each file
+as an object with its content type and Cache-Control header, or
+memory:// to check the files without writing them. Objects that already
+hold the same content are not uploaded again, unless the credentials
+may only write objects and not read them, when every file is uploaded.
+Uploads to Cloud Storage
+take an HMAC key from GS_ACCESS_KEY_ID and GS_SECRET_ACCESS_KEY.
+Uploads to S3 find their credentials and region as the AWS CLI does, in
+AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION or else the
+profile in AWS_PROFILE. As production buckets are rarely writable by
+default credentials, -aws-profile names another profile, -aws-region
+the bucket's region, and -aws-role-arn a role to assume, with the
+external ID its trust policy requires in -aws-external-id:
+
+	vanity -o s3://bucket -aws-profile deploy \
+	  -aws-role-arn arn:aws:iam::123456789012:role/vanity \
+	  -aws-external-id "$EXTERNAL_ID" ...
+
+Services compatible with S3 are named by an endpoint parameter:
+
+	vanity -o 's3://bucket?endpoint=http://localhost:9000' ...
+
+Files larger than -upload-part-size MiB are uploaded in parts, at most
+-upload-concurrency of them at once, and -upload-limit caps the
+bandwidth all uploads use together, so a large first publish neither
+saturates a CI runner nor is throttled by the provider.
+
+Buckets whose policies require encryption or an ACL on each object are
+written with -s3-sse, -s3-kms-key and -s3-acl:
+
+	vanity -o s3://bucket -s3-kms-key alias/vanity \
+	  -s3-acl bucket-owner-full-control ...
+
+Where the bucket's owner enforces its ownership of objects, ACLs are
+disabled, and -s3-acl is dropped with a warning once the bucket refuses
+it.
+
+Hosts that serve files only from a key-value store, such as Consul or
+etcd, can load the export written with -kv, which holds every file
+keyed by its name in the format read by consul kv import. The preview
+command serves such an export in place of a directory:
+
+	vanity -o out -kv kv.json ... &&
+	consul kv import -prefix=vanity/ @out/kv.json
+	vanity preview -kv out/kv.json
+
+Platform teams deploying through GitOps can instead commit the
+Kubernetes manifests written with -kubernetes: a ConfigMap holding the
+files, and nginx serving them behind an Ingress for each domain, which
+expects its certificate in the Secret vanity-tls:
+
+	vanity -o out -kubernetes vanity.yaml ... &&
+	kubectl apply -f out/vanity.yaml
+
+Comparing with a deployed domain
+
+The diff command generates the same files in memory and reports those
+that differ from what each domain, and each of its aliases, currently
+serves:
+
+	go list vanity.example.com/... | \
+	  vanity diff -replace vanity.example.com=github.com/actual-user
+
+The files of a single domain may instead be compared with those served
+under -base, such as a staging deployment:
+
+	go list vanity.example.com/... | \
+	  vanity diff -base https://staging.vanity.example.com \
+	    -replace vanity.example.com=github.com/actual-user
+
+Exit status
+
+The exit status is 0 on success, 2 for invalid usage, 3 when a package
+or its repository cannot be loaded, 4 when output cannot be written,
+and 1 for any other error. The diff and lint commands exit with 5 when
+they find a problem, as does the audit command when a repository
+cannot be reached.
+
+Finding dangling repositories
+
+The audit command checks that the repository of each import path
+exists and can be reached, reporting those that go get would fail to
+download. With -private, it also reports modules whose names would be
+revealed to the public checksum database:
+
+	go list vanity.example.com/... | \
+	  vanity audit -replace vanity.example.com=github.com/actual-user
+
+Exporting mappings
+
+The export command prints the resolved mapping of each import path to
+its repository, version control system, branch and page, as JSON or
+CSV, for auditing or for configuring other systems:
+
+	go list vanity.example.com/... | \
+	  vanity export -format csv \
+	    -replace vanity.example.com=github.com/actual-user
+
+Checking pages
+
+The lint command reads HTML files, or directories of them, as the go
+command does, and reports meta tags it would reject or ignore:
+
+	vanity lint vanity.example.com
+
+The stats command summarizes a directory of generated files without
+generating them again: the number of pages sending the go command to
+each repository, and the providers and branches their source links
+refer to.
+
+	vanity stats -dir out
+
+With -validate, generation fails instead if any page written is not
+well-formed HTML with a single head holding its meta tags, as is easy
+to miss when customizing the templates.
+
+Serving
+
+Rather than writing files, the serve command generates them in memory
+and serves them directly. With -autocert, it serves HTTPS using
+certificates obtained from Let's Encrypt:
+
+	go list vanity.example.com/... | \
+	  vanity serve -autocert /var/cache/vanity \
+	    -replace vanity.example.com=github.com/actual-user
+
+The -admin flag serves metrics and health checks on a separate address.
+The server stops gracefully on SIGINT or SIGTERM.
+
+Paths without generated pages may be served from mappings that other
+tooling keeps in a store shared by a fleet of servers: Redis, given by
+-redis, where each key is -redis-prefix followed by an import path and
+its value the repository, or a DynamoDB table, given by -dynamodb, with
+the import path as its partition key "path" and the repository in the
+attribute "repository". DynamoDB is reached with the same credentials,
+region and role as uploads to S3. A mapping applies to every package
+beneath its path. Mappings are cached for -cache-ttl, the absence of
+one for -cache-miss-ttl, and at most -cache-size of them at once:
+
+	vanity serve -dynamodb vanity-paths -aws-region eu-west-1 \
+	  -cache-ttl 5m -json /etc/vanity/packages.json
+
+On a virtual machine, -print-systemd prints a systemd socket and
+service unit running the serve command with the other arguments given.
+When started by socket activation, the server accepts requests on the
+sockets passed rather than listening itself, so it needs no privileges
+to serve ports 80 and 443; sockets are matched by their
+FileDescriptorName, http, https or admin, or else in that order:
+
+	vanity serve -print-systemd -autocert /var/lib/vanity \
+	  -json /etc/vanity/packages.json
+
+To run the serve command in Kubernetes, the helm command resolves the
+packages and prints the values of a Helm chart: the domains for its
+Ingress, the configuration file as it is, the packages as a -json
+document, the arguments of the serve command given both, and the
+Secret holding the certificate. Generating the values from the
+configuration on each change keeps it the single source of truth:
+
+	go list vanity.example.com/... | \
+	  vanity helm -config vanity.json > values.yaml
+
+The preview command instead serves files already written to a
+directory, as a static host would, for checking them before they are
+deployed. Requests for localhost are answered for the domain in the
+directory:
+
+	vanity preview -dir out
+	curl 'http://localhost:8080/foo?go-get=1'
+
+Testing templates
+
+The package whitehouse.id.au/vanity/vanitytest compares the files
+generated for fixed input with golden copies, so that a repository
+customizing the templates can check its changes in its Go tests. With
+-vanitytest.update, it replaces the copies:
+
+	vanitytest.Golden(t, "testdata/golden",
+		"-json", "testdata/packages.json", "-template", "page.html")
+
+The snapshot command does the same outside of Go tests, replacing the
+copies with -update:
+
+	vanity snapshot -golden testdata/golden \
+	  -json testdata/packages.json -template page.html
+
+Untrusted templates
+
+Templates and configuration taken from a repository shared with others
+can be generated from with -restricted, so that a malicious template
+cannot send local files elsewhere: templates may not fetch other hosts
+with integrity, configuration may not run commands as providers, and
+no file written may exceed 1 MiB.
+
+Signing output
+
+With -manifest and -sign, the SHA-256 sum of every file written is
+listed in a manifest signed with an Ed25519 key, such as one created by
+"openssl genpkey -algorithm ed25519". A deployment can check the files
+before uploading them:
+
+	vanity verify -key vanity.pub out/MANIFEST
 */
 package main // import "whitehouse.id.au/vanity"
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"go/build"
 	"html/template"
 	"io"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	texttemplate "text/template"
 
 	"github.com/Masterminds/vcs"
 )
 
+// maxLineSize is the longest package path accepted from the input.
+const maxLineSize = 1024 * 1024
+
+// pipelineDepth is the number of packages buffered between each stage
+// of generation, bounding memory use however long the input is.
+const pipelineDepth = 64
+
 var (
-	replacerFlag replacerValue
-	outputFlag   string
+	replacerFlag    replacerValue
+	outputFlag      string
+	nullFlag        bool
+	summaryFlag     bool
+	configFlag      string
+	badgeFlag       bool
+	indexFlag       bool
+	topicsFlag      bool
+	readmeFlag      bool
+	htmlExtFlag     bool
+	cleanURLsFlag   string
+	insecureFlag    bool
+	headersFlag     bool
+	fileFlag        stringsValue
+	jsonFlag        string
+	reposFlag       string
+	sortFlag        bool
+	forceFlag       bool
+	migrateFlag     migrationsValue
+	assetsFlag      string
+	fingerprintFlag bool
+	dirFlag         string
+	templateFlag    string
+	goGetTplFlag    string
+	redirectFlag    string
+	delayFlag       int
+	langFlag        string
+	faviconsFlag    bool
+	iconDirFlag     string
+	errorFlag       bool
+	errorTplFlag    string
+	privateFlag     bool
+	athensFlag      string
+	cloudFrontFlag  string
+	qrFlag          string
+	statsFlag       bool
+	graphFlag       bool
+	manifestFlag    string
+	validateFlag    bool
+	provenanceFlag  bool
+	mirrorFlag      bool
+	progressFlag    bool
+	testsFlag       bool
+	kvFlag          string
+	kubernetesFlag  string
+	indexPageFlag   int
+	indexSplitFlag  string
+	restrictedFlag  bool
+	signFlag        string
+	titleFlag       string
+
+	cpuProfileFlag string
+	memProfileFlag string
+)
+
+// goGetPage, if not empty, names a page written beside each index.html
+// with only the meta tags read by the go command. Hosts that can route
+// on the "go-get=1" query parameter serve it to the go command, and
+// the full page to browsers.
+var goGetPage string
+
+// Exit codes distinguish the category of failure for scripts.
+const (
+	exitError  = 1
+	exitUsage  = 2 // matches flag.ExitOnError
+	exitLoad   = 3
+	exitOutput = 4
 )
 
 func init() {
-	flag.Var(&replacerFlag, "replace", "a comma-separated list of canonical=noncanonical pairs of package paths")
-	flag.StringVar(&outputFlag, "o", "", "base directory where HTML files should be created")
+	addFlags(flag.CommandLine)
+}
+
+// addFlags defines the flags that control generation in fs.
+func addFlags(fs *flag.FlagSet) {
+	fs.Var(&replacerFlag, "replace", "a comma-separated list of canonical=noncanonical pairs of package paths")
+	fs.StringVar(&outputFlag, "o", "", "base directory where HTML files should be created, or a URL such as file:///srv/www, s3://bucket/prefix, gs://bucket/prefix or memory://")
+	fs.IntVar(&uploadConcurrencyFlag, "upload-concurrency", 4, "most parts of a file uploaded at once to s3:// or gs://")
+	fs.IntVar(&uploadPartSizeFlag, "upload-part-size", 8, "size in MiB of the parts in which files larger than it are uploaded to s3:// or gs://, at least 5")
+	fs.IntVar(&uploadLimitFlag, "upload-limit", 0, "most KiB per second uploaded to s3:// or gs:// (default unlimited)")
+	fs.StringVar(&s3SSEFlag, "s3-sse", "", `server-side encryption of each object uploaded to s3://: "AES256" for keys managed by S3, or "aws:kms" for a KMS key (default the bucket's)`)
+	fs.StringVar(&s3KMSKeyFlag, "s3-kms-key", "", "ID or ARN of the KMS key encrypting each object uploaded to s3://, implying -s3-sse aws:kms (default the account's AWS managed key)")
+	fs.StringVar(&s3ACLFlag, "s3-acl", "", "canned ACL of each object uploaded to s3://, such as bucket-owner-full-control; not set if the bucket's owner enforces ownership")
+	fs.StringVar(&awsProfileFlag, "aws-profile", "", "profile of the AWS shared credentials and config files whose credentials upload to s3://, rather than those in the environment (default $AWS_PROFILE)")
+	fs.StringVar(&awsRegionFlag, "aws-region", "", "AWS region of the bucket named by -o s3:// (default $AWS_REGION, or the profile's)")
+	fs.StringVar(&awsRoleARNFlag, "aws-role-arn", "", "ARN of an IAM role to assume for uploads to s3://")
+	fs.StringVar(&awsExternalIDFlag, "aws-external-id", "", "external ID required to assume -aws-role-arn")
+	fs.Var(&fileFlag, "f", "read packages one per line from a file, or standard input if \"-\"; may be repeated")
+	fs.StringVar(&assetsFlag, "assets", "", "copy the files in this directory to "+assetsDir+"/ at the root of each domain, for templates to refer to with the asset function")
+	fs.BoolVar(&fingerprintFlag, "fingerprint", false, "serve each of the -assets under a name including a hash of its content, rewriting references to them from templates and stylesheets, so they may be cached forever")
+	fs.Var(&migrateFlag, "migrate", "also publish each page on a domain being renamed, as old=new, with a deprecation notice and go-import meta tags for the old import path; may be repeated")
+	fs.BoolVar(&forceFlag, "force", false, "generate pages even when checks find they would not work, such as when they send go get back to the vanity domain or differ only in case, warning instead of failing")
+	fs.BoolVar(&testsFlag, "tests", false, "also generate pages for packages holding only tests, such as examples, rather than skipping them")
+	fs.BoolVar(&sortFlag, "sort", false, "generate pages in order of import path, rather than as packages are read, at the cost of reading all input first")
+	fs.StringVar(&reposFlag, "repos", "", "a comma-separated list of repositories, such as github.com/actual-user/foo, each given a single page at the import path -replace maps to it, without loading any packages")
+	fs.StringVar(&dirFlag, "dir", "", "find the modules in every repository checked out beneath this directory, rather than loading packages")
+	fs.StringVar(&jsonFlag, "json", "", "read packages and their repositories from a JSON document in a file, or standard input if \"-\"")
+	fs.BoolVar(&nullFlag, "0", false, "packages read from standard input are separated by NUL characters instead of newlines")
+	fs.BoolVar(&summaryFlag, "summary", false, "print a summary of the run to standard error")
+	fs.BoolVar(&progressFlag, "progress", false, "show progress on standard error: a progress bar on a terminal, or otherwise the go-import meta tag content of each page as it is written")
+	fs.BoolVar(&restrictedFlag, "restricted", false, "for templates and configuration that are not trusted: disallow commands and fetching other hosts, and fail if any file written is over 1 MiB")
+	fs.StringVar(&configFlag, "config", "", "JSON file with per-path settings")
+	fs.BoolVar(&mirrorFlag, "mirror", false, "advertise the mirror configured for each path that has one instead of its repository, such as while the repository's host is unavailable")
+	fs.StringVar(&templateFlag, "template", "", "html/template file used for each page instead of the default")
+	fs.StringVar(&redirectFlag, "redirect", "meta", `how browsers are sent to the documentation: "meta" for an immediate meta refresh, "delay" for a refresh after a countdown, "js" for a script so that the page remains crawlable, or "none" for only a link`)
+	fs.IntVar(&delayFlag, "redirect-delay", 5, "seconds before browsers are redirected with -redirect delay")
+	fs.StringVar(&langFlag, "lang", "en", "language of the generated pages; the text of the built-in pages is translated for de, en, es and fr")
+	fs.StringVar(&titleFlag, "title", defaultTitle, "text/template producing the title of each page")
+	fs.StringVar(&goGetPage, "go-get-page", "", "also create a page with only the meta tags read by the go command under this name beside each index.html, such as go-get.html")
+	fs.StringVar(&goGetTplFlag, "go-get-template", "", "html/template file used for each -go-get-page instead of the default")
+	fs.BoolVar(&badgeFlag, "badges", false, "also create an SVG badge for each path under badge/ at the root of its domain in the output directory")
+	fs.StringVar(&qrFlag, "qr", "", `also create a PNG QR code for each path under qr/ at the root of its domain in the output directory, encoding its documentation URL if "docs" or its go get command if "get"`)
+	fs.BoolVar(&indexFlag, "index", false, "also create a searchable index of all paths at the root of each domain in the output directory")
+	fs.BoolVar(&statsFlag, "stats", false, "show the number of packages and direct dependencies of each module on the index")
+	fs.BoolVar(&graphFlag, "graph", false, "also create a page showing the dependencies between the modules of each domain, with the graph in DOT, at the root of each domain in the output directory")
+	fs.IntVar(&indexPageFlag, "index-page-size", 1000, "most paths listed on each page of a domain index, beyond which it continues on index-2.html and so on, with every path searched from search.json (0 for no limit)")
+	fs.StringVar(&indexSplitFlag, "index-split", "", `split each domain index into pages linked from its root: "letter" by the first letter of each path, or "repository" by repository`)
+	fs.BoolVar(&topicsFlag, "topics", false, "categorize the index by repository topics fetched from the provider API")
+	fs.BoolVar(&readmeFlag, "readme", false, "include the README.md of each module on its page as preformatted text")
+	fs.BoolVar(&htmlExtFlag, "html-ext", false, "also create <path>.html beside each <path>/index.html, for hosts that serve /path from path.html")
+	fs.BoolVar(&insecureFlag, "insecure", false, "refer to repositories and documentation over HTTP rather than HTTPS, for testing in environments without HTTPS; never use this for a production domain")
+	fs.StringVar(&cleanURLsFlag, "clean-urls", "", "also create a list with this name in the output directory pairing each <path>/index.html with the extensionless object <path>, for hosts that serve neither")
+	fs.StringVar(&cpuProfileFlag, "cpuprofile", "", "write a CPU profile of generation to this file")
+	fs.StringVar(&memProfileFlag, "memprofile", "", "write a memory profile to this file once generation finishes")
+	fs.BoolVar(&privateFlag, "private", false, "show how to configure GOPRIVATE for the domain on each page and index, for domains serving private modules")
+	fs.BoolVar(&faviconsFlag, "favicons", false, "also create favicons and a web manifest at the root of each domain in the output directory")
+	fs.StringVar(&iconDirFlag, "favicon-dir", "", "directory holding favicon.ico, favicon.png, apple-touch-icon.png or site.webmanifest to use with -favicons instead of the defaults")
+	fs.BoolVar(&errorFlag, "error-page", false, "also create a 404.html error page at the root of each domain in the output directory")
+	fs.StringVar(&errorTplFlag, "error-template", "", "html/template file used for -error-page instead of the default, given the Domain, Lang, Msg, Paths and Config")
+	fs.StringVar(&athensFlag, "athens", "", "also create an Athens proxy download mode file with this name in the output directory, fetching the generated paths and redirecting others to proxy.golang.org")
+	fs.BoolVar(&validateFlag, "validate", false, "check that every HTML file written is well-formed, with a single head holding its meta tags, failing the run if not")
+	fs.BoolVar(&provenanceFlag, "provenance", false, "also create "+provenanceFile+" in the output directory, recording the version of vanity, the time, a hash of the -config and the number of paths, to identify the run that produced a deployment")
+	fs.StringVar(&kvFlag, "kv", "", "also create an export with this name in the output directory holding every file written, as JSON read by \"consul kv import\", for hosts serving files from a key-value store")
+	fs.StringVar(&kubernetesFlag, "kubernetes", "", "also create Kubernetes manifests with this name in the output directory, serving every file written from a ConfigMap with nginx behind an Ingress")
+	fs.StringVar(&manifestFlag, "manifest", "", "also create a manifest with this name in the output directory, listing the SHA-256 sum of every file written")
+	fs.StringVar(&signFlag, "sign", "", "PEM file holding an Ed25519 private key with which to sign the -manifest, writing the signature beside it with the extension .sig")
+	fs.Var(cacheControlFlag, "cache-control", "set the Cache-Control header used by -headers, serve and uploads to s3:// or gs:// for a class of file, as class=value where the class is page, index, error, asset or immutable; may be repeated")
+	fs.StringVar(&cloudFrontFlag, "cloudfront", "", "also create the configuration of a CloudFront response headers policy with this name in the output directory, declaring the same security headers as -headers")
+	fs.BoolVar(&headersFlag, "headers", false, "also create a _headers file declaring security and caching headers at the root of each domain in the output directory")
+}
+
+// commands are the subcommands, named by the first argument, that
+// are run instead of generating output.
+var commands = map[string]func(args []string){
+	"audit":    auditMain,
+	"diff":     diffMain,
+	"doctor":   doctorMain,
+	"export":   exportMain,
+	"graph":    graphMain,
+	"helm":     helmMain,
+	"init":     initMain,
+	"lint":     lintMain,
+	"serve":    serveMain,
+	"preview":  previewMain,
+	"snapshot": snapshotMain,
+	"stats":    statsMain,
+	"verify":   verifyMain,
 }
 
 func main() {
+	log.SetOutput(redactWriter{os.Stderr})
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Usage = usage
 	flag.Parse()
 
-	// Packages are either read as extra arguments or one line at
-	// a time from standard input.
-	var reader io.Reader
-	if flag.NArg() > 0 {
-		reader = strings.NewReader(strings.Join(flag.Args(), "\n"))
-	} else {
-		reader = os.Stdin
+	if outputFlag != "" {
+		var err error
+		dest, err = openDestination(outputFlag)
+		exitOnErr(err, exitUsage)
+	}
+	generate(flag.Args())
+
+	if summaryFlag {
+		stats.print(os.Stderr)
+	}
+}
+
+// generate creates the output for the packages named by args, or read
+// from standard input if there are none, and returns the generator
+// holding what was written.
+func generate(args []string) *generator {
+	defer startProfiling()()
+	warnInsecure()
+	if restrictedFlag {
+		restrict()
+	}
+
+	if assetsFlag != "" {
+		err := loadAssets(assetsFlag)
+		exitOnErr(err, exitUsage)
+	}
+
+	if configFlag != "" {
+		var err error
+		config, err = loadConfig(configFlag)
+		exitOnErr(err, exitUsage)
+	}
+	if templateFlag != "" {
+		var err error
+		indexTpl, err = loadPageTemplate(templateFlag, indexTpl)
+		exitOnErr(err, exitUsage)
+	}
+	if errorTplFlag != "" {
+		var err error
+		errorTpl, err = loadPageTemplate(errorTplFlag, errorTpl)
+		exitOnErr(err, exitUsage)
+	}
+	if goGetTplFlag != "" {
+		var err error
+		minimalTpl, err = loadPageTemplate(goGetTplFlag, minimalTpl)
+		exitOnErr(err, exitUsage)
+	}
+	if titleFlag != defaultTitle {
+		var err error
+		titleTpl, err = texttemplate.New("title").Funcs(templateFuncs).Parse(titleFlag)
+		exitOnErr(err, exitUsage)
+	}
+	if _, ok := qrContents[qrFlag]; qrFlag != "" && !ok {
+		exitOnErr(fmt.Errorf("invalid -qr %q", qrFlag), exitUsage)
+	}
+	if !redirects[redirectFlag] {
+		exitOnErr(fmt.Errorf("invalid -redirect %q", redirectFlag), exitUsage)
+	}
+	if _, ok := indexSplits[indexSplitFlag]; indexSplitFlag != "" && !ok {
+		exitOnErr(fmt.Errorf("invalid -index-split %q", indexSplitFlag), exitUsage)
+	}
+	if strings.Contains(goGetPage, "/") || goGetPage == "index.html" {
+		exitOnErr(fmt.Errorf("invalid -go-get-page %q", goGetPage), exitUsage)
+	}
+
+	// Packages are read as extra arguments, one line at a time from
+	// files, or else from standard input.
+	var scanners []*bufio.Scanner
+	if len(args) > 0 {
+		scanners = append(scanners, newScanner(strings.NewReader(strings.Join(args, "\n")), bufio.ScanLines))
+	}
+	for _, name := range fileFlag {
+		if name == "-" {
+			scanners = append(scanners, stdinScanner())
+			continue
+		}
+
+		f, err := os.Open(name)
+		exitOnErr(err, exitUsage)
+		defer f.Close()
+		scanners = append(scanners, newScanner(f, bufio.ScanLines))
+	}
+	if len(scanners) == 0 && jsonFlag == "" && reposFlag == "" && dirFlag == "" {
+		scanners = append(scanners, stdinScanner())
 	}
 
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		pkg, err := load(scanner.Text())
-		exitOnErr(err)
+	var doc Input
+	if jsonFlag != "" {
+		var err error
+		doc, err = loadInput(jsonFlag)
+		exitOnErr(err, exitUsage)
+	}
+	if reposFlag != "" {
+		repos, err := repoInputs(reposFlag)
+		exitOnErr(err, exitUsage)
+		doc.Packages = append(doc.Packages, repos...)
+	}
+	if dirFlag != "" {
+		modules, err := walkInputs(dirFlag)
+		exitOnErr(err, exitLoad)
+		doc.Packages = append(doc.Packages, modules...)
+	}
 
-		err = writePackageIndex(pkg)
-		exitOnErr(err)
+	var validate *validateDestination
+	if validateFlag && dest != nil {
+		validate = &validateDestination{destination: dest, problems: make(map[string][]string)}
+		dest = validate
+	}
+	var kv *kvDestination
+	if (kvFlag != "" || kubernetesFlag != "") && dest != nil {
+		kv = &kvDestination{destination: dest, files: make(map[string]*bytes.Buffer)}
+		dest = kv
 	}
+	if manifestFlag != "" && dest != nil {
+		dest = &manifestDestination{destination: dest, sums: make(map[string]string)}
+	}
+
+	g := &generator{written: make(map[string]bool), imports: make(map[string]string), validate: validate, kv: kv}
+	progress.show = progressFlag
+	g.run(doc.Packages, scanners)
+	g.finish()
+	progress.done()
+	return g
 }
 
-func usage() {
-	fmt.Fprintf(os.Stderr, "usage: %s [options] [packages]\n", os.Args[0])
-	flag.PrintDefaults()
+// generator accumulates the pages generated in a run, so that pages
+// covering the whole domain can be written once all are known.
+type generator struct {
+	// written tracks pages already generated, so a module path
+	// shared by several packages is only written once.
+	written map[string]bool
+	entries []indexEntry
+
+	// imports holds the go-import meta tag content of each page
+	// written, to detect paths given again with another.
+	imports map[string]string
+
+	// validate, if set, holds the problems found by -validate.
+	validate *validateDestination
+
+	// kv, if set, holds the files exported by -kv and -kubernetes.
+	kv *kvDestination
 }
 
-func exitOnErr(err error) {
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
+// pending is a page resolved from the input, waiting to be written.
+type pending struct {
+	page page
+	repo Repo
+
+	// err, if set, ends the run with the exit code code in place of
+	// a page, as only the writing goroutine may exit.
+	err  error
+	code int
+}
+
+// run generates the pages for packages described by inputs, and then
+// those named by each scanner.
+//
+// Reading, resolving and writing each run concurrently, connected by
+// bounded channels, so that slow output does not stall reading the
+// input until the channels fill. Pages are still written in the order
+// they are read.
+func (g *generator) run(inputs []InputPackage, scanners []*bufio.Scanner) {
+	names := make(chan string, pipelineDepth)
+	// readErr is the error that stopped reading names, set before
+	// names is closed.
+	var readErr error
+	go func() {
+		defer close(names)
+
+		// Repeated names are skipped. With -sort, names are held
+		// until all have been read.
+		seen := make(map[string]bool)
+		var sorted []string
+		for _, scanner := range scanners {
+			for scanner.Scan() {
+				// Blank lines and comments are skipped.
+				name := strings.TrimSpace(scanner.Text())
+				if name == "" || strings.HasPrefix(name, "#") || seen[name] {
+					continue
+				}
+				seen[name] = true
+				progress.queue(1)
+				if sortFlag {
+					sorted = append(sorted, name)
+					continue
+				}
+				names <- name
+			}
+			if readErr = scanner.Err(); readErr != nil {
+				return
+			}
+		}
+
+		sort.Strings(sorted)
+		for _, name := range sorted {
+			names <- name
+		}
+	}()
+
+	if sortFlag {
+		sort.SliceStable(inputs, func(i, j int) bool {
+			return inputs[i].ImportPath < inputs[j].ImportPath
+		})
+	}
+
+	progress.queue(len(inputs))
+	pages := make(chan pending, pipelineDepth)
+	go func() {
+		defer close(pages)
+		for _, p := range inputs {
+			page, err := resolveInput(p)
+			if err != nil {
+				pages <- pending{err: err, code: exitLoad}
+				return
+			}
+			pages <- page
+			progress.resolve()
+		}
+
+		// Paths already resolved are skipped without loading
+		// their README again, and the files of each module are
+		// read once for all its packages.
+		seen := make(map[string]bool)
+		modules := make(map[string]*moduleFiles)
+		for name := range names {
+			resolved, err := resolvePackage(name, seen, modules)
+			if err != nil {
+				pages <- pending{err: err, code: exitLoad}
+				return
+			}
+			for _, p := range resolved {
+				pages <- p
+			}
+			progress.resolve()
+		}
+		if readErr != nil {
+			pages <- pending{err: readErr, code: exitError}
+		}
+	}()
+
+	for p := range pages {
+		exitOnErr(p.err, p.code)
+		if !config.allowed(p.page.ImportPath) {
+			exitOnErr(&PathError{ImportPath: p.page.ImportPath, Err: ErrNotAllowed}, exitLoad)
+		}
+		err := g.add(p.page, p.repo)
+		exitOnErr(err, exitOutput)
 	}
 }
 
-func writePackageIndex(pkg *build.Package) error {
+// resolvePackage returns the pages for the package name, found in the
+// GOPATH, skipping any import paths in seen. The files read from each
+// module are kept in modules.
+func resolvePackage(name string, seen map[string]bool, modules map[string]*moduleFiles) ([]pending, error) {
+	pkg, err := load(name)
+	var noGo *build.NoGoError
+	if errors.As(err, &noGo) && hasTestFiles(noGo.Dir) {
+		logf("%s: skipped, as it holds only tests; use -tests to generate its page\n", name)
+		stats.skip()
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	// Determine the base package that contains the VCS.
 	root, err := vcsRoot(pkg)
 	if err != nil {
+		return nil, err
+	}
+	stats.addPackage(root)
+
+	// Source links for modules kept in a subdirectory must point
+	// into that subdirectory.
+	dir, err := moduleDir(pkg, root)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := repository{
+		Root:   root,
+		Dir:    dir,
+		SrcDir: filepath.Join(pkg.SrcRoot, filepath.FromSlash(root)),
+	}
+	if err := forced(checkReplaced(root, repo.repo().Repository)); err != nil {
+		return nil, err
+	}
+	vcs, err := repo.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	// A nested module needs a page at its module path, even if no
+	// package lives there.
+	paths := []string{pkg.ImportPath}
+	if dir != "" {
+		paths = append(paths, path.Join(root, dir))
+	}
+
+	// A repository at the bare domain is served from the domain's
+	// root page, rather than the index of its packages.
+	if !strings.Contains(root, "/") {
+		paths = append(paths, root)
+	}
+	var pages []pending
+	for _, importPath := range paths {
+		if seen[importPath] {
+			continue
+		}
+		seen[importPath] = true
+
+		files, err := repo.files(modules)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, pending{
+			page: page{
+				ImportPath: importPath,
+				Display:    config.Lookup(importPath).Display,
+				Readme:     files.readme,
+				Module:     files.mod,
+				Stats:      files.stats,
+				Docs:       docsURL(importPath),
+				VCS:        vcs,
+			},
+			repo: repo.repo(),
+		})
+	}
+	return pages, nil
+}
+
+// add generates the page p, for a package held in the repository r.
+func (g *generator) add(p page, r Repo) error {
+	if g.written[p.ImportPath] {
+		// The same path may be given twice, such as in both -json
+		// and the arguments, but only the first page is kept.
+		if goImport := p.VCS.GoImport(); goImport != g.imports[p.ImportPath] {
+			warnf("%s: also maps to %q, ignored in favour of %q\n", p.ImportPath, goImport, g.imports[p.ImportPath])
+			stats.skip()
+		}
+		return nil
+	}
+
+	g.written[p.ImportPath] = true
+	g.imports[p.ImportPath] = p.VCS.GoImport()
+	docs := p.Docs
+	if insecureFlag {
+		docs = insecureURLs(docs)
+	}
+	g.entries = append(g.entries, indexEntry{
+		ImportPath: p.ImportPath,
+		Docs:       docs,
+		Repository: r.Repository,
+		Dir:        r.Dir,
+		Branch:     r.branch(),
+		Tags:       config.Lookup(p.ImportPath).Tags,
+		Module:     p.Module,
+		Stats:      p.Stats,
+		VCS:        p.VCS,
+	})
+
+	p.Clone = newCloneHelp(r, p.VCS.GoImport())
+	if err := writePackageIndex(p); err != nil {
 		return err
 	}
+	progress.wrote(p.ImportPath, p.VCS.GoImport())
+	if badgeFlag && dest != nil {
+		if err := writeBadge(p.ImportPath); err != nil {
+			return err
+		}
+	}
+	if qrFlag != "" && dest != nil {
+		if err := writeQR(p); err != nil {
+			return err
+		}
+	}
+
+	// The page is also published at any path being renamed to its
+	// own.
+	for _, m := range migrations(p.ImportPath) {
+		if err := g.add(movedPage(p, m), r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish writes the pages covering each domain once all packages have
+// been added.
+func (g *generator) finish() {
+	checkLoops(g.entries, g.written)
+	checkCaseCollisions(g.written)
+
+	if indexFlag && dest != nil {
+		if topicsFlag {
+			err := fetchTopics(g.entries)
+			exitOnErr(err, exitLoad)
+		}
+
+		err := writeIndexes(g.entries, g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if headersFlag && dest != nil {
+		err := writeHeaders(g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if cleanURLsFlag != "" && dest != nil {
+		err := writeCleanURLs(cleanURLsFlag, g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if cloudFrontFlag != "" && dest != nil {
+		err := writeCloudFront(cloudFrontFlag, g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if graphFlag && dest != nil {
+		err := writeGraphs(g.entries, g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if athensFlag != "" && dest != nil {
+		err := writeAthens(athensFlag, g.entries)
+		exitOnErr(err, exitOutput)
+	}
+
+	if assetsFlag != "" && dest != nil {
+		err := writeAssets(g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if len(config.Aliases) > 0 && dest != nil {
+		err := writeAliases(g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if len(config.Retired) > 0 && dest != nil {
+		err := writeRetired(g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if errorFlag && dest != nil {
+		err := writeErrorPages(g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	if faviconsFlag && dest != nil {
+		err := writeFavicons(g.written, iconDirFlag)
+		exitOnErr(err, exitOutput)
+	}
+
+	if provenanceFlag && dest != nil {
+		err := writeProvenance(g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	// Invalid pages fail the run before they are signed.
+	if g.validate != nil {
+		checkOrWarn(g.validate.err(), exitOutput)
+	}
+
+	if kvFlag != "" && g.kv != nil {
+		err := writeKV(g.kv, kvFlag)
+		exitOnErr(err, exitOutput)
+	}
+
+	if kubernetesFlag != "" && g.kv != nil {
+		err := writeKubernetes(g.kv, kubernetesFlag, g.written)
+		exitOnErr(err, exitOutput)
+	}
+
+	// The manifest lists every other file, so it is written last.
+	if m, ok := dest.(*manifestDestination); ok {
+		err := writeManifest(m, manifestFlag, signFlag)
+		exitOnErr(err, exitOutput)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s audit [-timeout d] [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s diff [-base url] [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s doctor [-timeout d] [options] [domains]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s export [-format json|csv] [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s graph [-format dot|json] [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s helm [-tls-secret name] [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s init [-config name] [-timeout d]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s lint [paths]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s preview [-dir dir | -kv name] [-addr addr] [-domain domain] [-go-get-page name] [-watch -- [options] [packages]]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s serve [-addr addr | -autocert dir] [-admin addr] [-access-log] [-print-systemd] [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s snapshot -golden dir [-update] [options] [packages]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s stats [-dir dir]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s verify -key key.pub manifest\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// checkOrWarn exits with code if a check failed with err, or with
+// -force prints it as a warning and continues.
+func checkOrWarn(err error, code int) {
+	exitOnErr(forced(err), code)
+}
+
+// forced returns err, the failure of a check, unless -force is set, in
+// which case it prints it as a warning and returns nil.
+func forced(err error) error {
+	if err != nil && forceFlag {
+		warnf("%v\n", err)
+		return nil
+	}
+	return err
+}
+
+// warnf prints a warning, counting it in the summary.
+func warnf(format string, args ...any) {
+	stats.warn()
+	logf("warning: "+format, args...)
+}
+
+func exitOnErr(err error, code int) {
+	if err != nil {
+		progress.done()
+		logf("%s\n", err)
+		stats.fail()
+		if summaryFlag {
+			stats.print(os.Stderr)
+		}
+		os.Exit(code)
+	}
+}
+
+// page is the data used to render the page for an import path, by the
+// built-in templates or one given by -template.
+type page struct {
+	ImportPath string
+	Display    Display
+	Readme     string
+
+	// Module is the go.mod file of the page's module, if known.
+	Module *goMod
+
+	// Stats, if computed by -stats, summarize the module.
+	Stats *moduleStats
+
+	// Docs is the URL of the package's documentation, to which
+	// browsers are redirected.
+	Docs string
+	VCS  Provider
+
+	// Redirect is the value of -redirect, and Delay the seconds
+	// before a delayed redirect. Script performs the redirect or
+	// countdown when one is used.
+	Redirect string
+	Delay    int
+	Script   template.JS
+
+	// Title is the title of the page, produced by -title, Lang its
+	// language and Msg the text of the built-in pages in it.
+	Title string
+	Lang  string
+	Msg   messages
+
+	// Private, if set by -private, is the GOPRIVATE pattern
+	// matching the page's domain.
+	Private string
+
+	// Scheme is the scheme of the page's own URL: "https", or
+	// "http" with -insecure.
+	Scheme string
+
+	// Clone, if set, tells git users how to clone the repository
+	// by another protocol.
+	Clone *cloneHelp
+
+	// MovedTo, if set by -migrate or a moved path, is the new
+	// import path of a page published at its old one.
+	MovedTo string
+}
+
+// defaultTitle is the default value of -title, naming the page by its
+// display name if it has one.
+const defaultTitle = "{{ with .Display.Name }}{{ . }}{{ else }}{{ .ImportPath }}{{ end }}"
+
+// titleTpl produces the title of each page.
+var titleTpl = texttemplate.Must(texttemplate.New("title").Parse(defaultTitle))
+
+// redirects are the values accepted by -redirect.
+var redirects = map[string]bool{
+	"meta":  true,
+	"delay": true,
+	"js":    true,
+	"none":  true,
+}
+
+// redirectScript redirects browsers to the documentation when
+// -redirect is "js", or counts down to the refresh when it is "delay".
+// It is kept separately so that its hash can be allowed by a security
+// policy.
+const redirectScript = `
+(function() {
+	var link = document.getElementById("docs");
+	if (link.getAttribute("data-redirect") === "js") {
+		location.replace(link.href);
+		return;
+	}
+
+	var countdown = document.getElementById("countdown");
+	var seconds = Number(countdown.textContent);
+	var timer = setInterval(function() {
+		countdown.textContent = --seconds;
+		if (seconds <= 0) {
+			clearInterval(timer);
+		}
+	}, 1000);
+})();
+`
+
+// docsURL returns the default documentation URL for importPath.
+func docsURL(importPath string) string {
+	return "https://godoc.org/" + importPath
+}
+
+func writePackageIndex(p page) error {
+	if goGetPage != "" && dest != nil {
+		w, err := create(path.Join(p.ImportPath, goGetPage))
+		if err != nil {
+			return err
+		}
+		err = renderPage(w, minimalTpl, p)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
 
 	// Open an output for writing the HTML template.
-	w, err := open(pkg.ImportPath)
+	w, err := open(p.ImportPath)
 	if err != nil {
 		return err
 	}
-	defer w.Close()
 
 	// Generate a HTML file with meta tags for each.
-	data := struct {
-		ImportPath string
-		VCS        GitHub
-	}{
-		ImportPath: pkg.ImportPath,
-		// FIXME: This currently only supports GitHub VCS endpoints.
-		VCS: GitHub{
-			ImportPath: root,
-			Repository: replacerFlag.Replace(root),
-		},
+	err = renderPage(w, indexTpl, p)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// renderPage writes p to w using tpl, redirecting browsers as chosen
+// by -redirect.
+func renderPage(w io.Writer, tpl *template.Template, p page) error {
+	var title strings.Builder
+	if err := titleTpl.Execute(&title, p); err != nil {
+		return err
+	}
+	p.Title = title.String()
+	p.Lang = langFlag
+	p.Msg = lookupMessages(langFlag)
+	if privateFlag {
+		p.Private, _, _ = strings.Cut(p.ImportPath, "/")
+	}
+
+	p.Scheme = "https"
+	if insecureFlag {
+		p.Scheme = "http"
+		p.Docs = insecureURLs(p.Docs)
+	}
+	p.Redirect = redirectFlag
+	p.Delay = delayFlag
+	if p.Redirect == "js" || p.Redirect == "delay" {
+		p.Script = template.JS(redirectScript)
 	}
-	return indexTpl.Execute(w, data)
+	return tpl.Execute(w, p)
 }
 
 func open(importPath string) (io.WriteCloser, error) {
-	// Write to console by default, unless a path is specified.
-	if outputFlag == "" {
+	// Write to console by default, unless a destination is specified.
+	if dest == nil {
 		return NopCloser(os.Stdout), nil
 	}
 
-	// Ensure the directory tree exists.
-	dir := filepath.Join(outputFlag, importPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	w, err := create(path.Join(importPath, "index.html"))
+	if err != nil {
+		return nil, err
+	}
+	if !htmlExtFlag {
+		return w, nil
+	}
+
+	// Some hosts serve "/path" from "path.html" rather than
+	// redirecting to "/path/", so write the page there too.
+	ext, err := create(importPath + ".html")
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return multiWriteCloser{w, ext}, nil
+}
+
+// create creates the slash-separated file name in the destination.
+// Destinations may write the file only once it is closed, so it is
+// counted as written only if closing it succeeds.
+func create(name string) (io.WriteCloser, error) {
+	w, err := dest.Create(name)
+	if err != nil {
 		return nil, err
 	}
+	return countedFile{w}, nil
+}
+
+// countedFile counts a file in the summary once it is written.
+type countedFile struct {
+	io.WriteCloser
+}
+
+func (f countedFile) Close() error {
+	if err := f.WriteCloser.Close(); err != nil {
+		return err
+	}
+	stats.write()
+	return nil
+}
+
+// newScanner returns a Scanner reading packages from r, split by split.
+func newScanner(r io.Reader, split bufio.SplitFunc) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	scanner.Split(split)
+	return scanner
+}
+
+// stdinScanner returns a Scanner reading packages from standard input.
+func stdinScanner() *bufio.Scanner {
+	split := bufio.ScanLines
+	if nullFlag {
+		split = scanNull
+	}
+	return newScanner(os.Stdin, split)
+}
 
-	return os.Create(filepath.Join(dir, "index.html"))
+// scanNull is a split function for a bufio.Scanner that returns each
+// NUL-terminated token, as produced by "find -print0".
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	// Return any remaining data that was not terminated.
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
 }
 
-// packages loads package information for each argument.
+// load finds the directory of the package name. Its sources are never
+// read, as only its location is needed, which keeps loading fast in
+// large trees.
 func load(name string) (*build.Package, error) {
-	return build.Import(name, ".", 0)
+	if !build.IsLocalImport(name) {
+		var err error
+		if name, err = asciiDomain(name); err != nil {
+			return nil, err
+		}
+		if err := checkImportPath(name); err != nil {
+			return nil, err
+		}
+	}
+	pkg, err := build.Import(name, ".", build.FindOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without reading the sources, a directory holding none is
+	// found as if it were a package. One holding only tests is a
+	// package to go test, and with -tests to vanity.
+	if !hasGoFiles(pkg.Dir) && !(testsFlag && hasTestFiles(pkg.Dir)) {
+		return nil, &build.NoGoError{Dir: pkg.Dir}
+	}
+	return pkg, nil
 }
 
 // vcsRoot returns the import path of the package VCS.
@@ -138,7 +1268,7 @@ func vcsRoot(pkg *build.Package) (string, error) {
 			continue
 		}
 
-		return "", err
+		return "", &PathError{ImportPath: pkg.ImportPath, Err: fmt.Errorf("%w: %v", ErrNoVCSRoot, err)}
 	}
 
 	// Convert directory back to an import path.
@@ -155,60 +1285,283 @@ func vcsRoot(pkg *build.Package) (string, error) {
 	return rel, nil
 }
 
+// repository describes the VCS repository holding a package.
+type repository struct {
+	// Root is the import path of the repository.
+	Root string
+
+	// Dir is the slash-separated path of the package's module
+	// within the repository, or empty if the module is at the root.
+	Dir string
+
+	// SrcDir is the local directory of the repository.
+	SrcDir string
+}
+
+// repo returns the Repo served by a Provider for the repository.
+func (r repository) repo() Repo {
+	repo := Repo{
+		ImportPath: r.Root,
+		Repository: config.repository(r.Root),
+		Dir:        r.Dir,
+	}
+	if s := config.Lookup(r.Root).Source; s != nil {
+		repo.Branch = s.Branch
+	}
+	return repo
+}
+
+// provider returns the Provider for the repository.
+func (r repository) provider() (Provider, error) {
+	repo := r.repo()
+	p, err := newProvider(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if s := config.Lookup(r.Root).Source; s != nil && !config.mirrored(r.Root) {
+		importPath := r.Root
+		if r.Dir != "" {
+			importPath += "/" + r.Dir
+		}
+		p = sourceOverride{
+			Provider: p,
+			goSource: fmt.Sprintf("%s _ %s %s",
+				importPath,
+				s.expand(s.Dir, repo.Repository, r.Dir),
+				s.expand(s.File, repo.Repository, r.Dir)),
+		}
+	}
+	return p, nil
+}
+
+// readme returns the contents of the README.md file for the module,
+// or the repository if the module does not have its own. If neither
+// has one, an empty string is returned.
+func (r repository) readme() (string, error) {
+	dirs := []string{filepath.Join(r.SrcDir, filepath.FromSlash(r.Dir))}
+	if r.Dir != "" {
+		dirs = append(dirs, r.SrcDir)
+	}
+
+	for _, dir := range dirs {
+		b, err := os.ReadFile(filepath.Join(dir, "README.md"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", nil
+}
+
+// goMod returns the module's go.mod file, or nil if it has none.
+func (r repository) goMod() (*goMod, error) {
+	return readGoMod(filepath.Join(r.SrcDir, filepath.FromSlash(r.Dir), "go.mod"))
+}
+
+// moduleFiles holds what is read from the files of a module, which is
+// the same for each of its packages.
+type moduleFiles struct {
+	readme string
+	mod    *goMod
+	stats  *moduleStats
+}
+
+// files returns the files of the module, read once and then kept in
+// cache by the module's directory.
+func (r repository) files(cache map[string]*moduleFiles) (*moduleFiles, error) {
+	dir := filepath.Join(r.SrcDir, filepath.FromSlash(r.Dir))
+	if f, ok := cache[dir]; ok {
+		return f, nil
+	}
+	f := new(moduleFiles)
+	var err error
+	if readmeFlag {
+		if f.readme, err = r.readme(); err != nil {
+			return nil, err
+		}
+	}
+	if f.mod, err = r.goMod(); err != nil {
+		return nil, err
+	}
+	if statsFlag {
+		if f.stats, err = r.moduleStats(); err != nil {
+			return nil, err
+		}
+	}
+	cache[dir] = f
+	return f, nil
+}
+
+// moduleDir returns the slash-separated path, relative to the VCS root,
+// of the nearest directory containing a go.mod file that holds the
+// package. This covers both major version subdirectories (such as
+// "v2") and repositories containing several modules. If the package
+// belongs to a module at the VCS root, an empty string is returned.
+func moduleDir(pkg *build.Package, root string) (string, error) {
+	rootDir := filepath.Join(pkg.SrcRoot, filepath.FromSlash(root))
+	for dir := pkg.Dir; dir != rootDir && dir != pkg.SrcRoot; dir = filepath.Dir(dir) {
+		_, err := os.Stat(filepath.Join(dir, "go.mod"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		rel, err := filepath.Rel(rootDir, dir)
+		if err != nil {
+			return "", err
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	return "", nil
+}
+
+// minimalTpl is a page for the go command, carrying only the meta tags
+// it reads.
+var minimalTpl = template.Must(template.New("minimal").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="go-import" content="{{ .VCS.GoImport }}">
+{{- with .VCS.GoSource }}
+<meta name="go-source" content="{{ . }}">
+{{- end }}
+</head>
+</html>
+`))
+
 var indexTpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
-<html>
+<html lang="{{ .Lang }}">
 <head>
 <meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{- block "head" . }}
+<title>{{ .Title }}</title>
+<link rel="canonical" href="{{ .Scheme }}://{{ with .MovedTo }}{{ . }}{{ else }}{{ .ImportPath }}{{ end }}">
+{{- end }}
+{{- block "meta" . }}
 <meta name="go-import" content="{{ .VCS.GoImport }}">
-<meta name="go-source" content="{{ .VCS.GoSource }}">
-<meta http-equiv="refresh" content="0; url=https://godoc.org/{{ .ImportPath }}">
+{{- with .VCS.GoSource }}
+<meta name="go-source" content="{{ . }}">
+{{- end }}
+{{- if eq .Redirect "meta" }}
+<meta http-equiv="refresh" content="0; url={{ .Docs }}">
+{{- else if eq .Redirect "delay" }}
+<meta http-equiv="refresh" content="{{ .Delay }}; url={{ .Docs }}">
+{{- end }}
+{{- end }}
 </head>
 <body>
-Nothing to see here; <a href="https://godoc.org/{{ .ImportPath }}">move along</a>.
+{{- block "body" . }}
+<h1>{{ .Title }}</h1>
+{{- with .MovedTo }}
+<p><strong>{{ printf $.Msg.Deprecated $.ImportPath . }}</strong></p>
+{{- end }}
+{{- with .Display.Description }}
+<p>{{ . }}</p>
+{{- end }}
+{{- with .Display.Links }}
+<ul>
+{{- range . }}
+<li><a href="{{ .URL }}">{{ .Title }}</a></li>
+{{- end }}
+</ul>
+{{- end }}
+{{- with .Readme }}
+<pre>{{ . }}</pre>
+{{- end }}
+{{- with .Module }}{{ with .Go }}
+<p>{{ printf $.Msg.Requires . }}</p>
+{{- end }}{{ end }}
+{{- with .Private }}
+<p>{{ $.Msg.Private }}</p>
+<pre>go env -w GOPRIVATE={{ . }}</pre>
+{{- end }}
+{{- with .Clone }}
+<p>{{ printf $.Msg.Clone .Protocol }}</p>
+<pre>{{ .Command }}</pre>
+{{- end }}
+<p>{{ .Msg.NothingHere }} <a id="docs" href="{{ .Docs }}" data-redirect="{{ .Redirect }}">{{ printf .Msg.DocsLink .ImportPath }}</a>.</p>
+{{- if eq .Redirect "delay" }}
+<p>{{ .Msg.Redirecting }} <span id="countdown">{{ .Delay }}</span> {{ .Msg.Seconds }}</p>
+{{- end }}
+{{- end }}
+{{- block "footer" . }}
+{{- with .VCS.Releases }}
+<p><a href="{{ . }}">{{ printf $.Msg.Releases $.ImportPath }}</a></p>
+{{- end }}
+{{- end }}
+{{- with .Script }}
+<script>{{ . }}</script>
+{{- end }}
 </body>
 </html>
 `))
 
 type replacerValue struct {
 	*strings.Replacer
+
+	// reverse maps repositories back to import paths.
+	reverse *strings.Replacer
 }
 
 func (v *replacerValue) Set(str string) error {
 	// Flatten comma-separated list of old=new pairs into a list.
-	var oldnew []string
+	var oldnew, newold []string
 	for _, pair := range strings.Split(str, ",") {
-		oldnew = append(oldnew, strings.Split(pair, "=")...)
+		parts := strings.Split(pair, "=")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid pair %q: expected canonical=noncanonical", pair)
+		}
+		if _, err := asciiDomains(parts); err != nil {
+			return err
+		}
+		oldnew = append(oldnew, parts...)
+		newold = append(newold, parts[1], parts[0])
 	}
 
 	v.Replacer = strings.NewReplacer(oldnew...)
+	v.reverse = strings.NewReplacer(newold...)
 	return nil
 }
 
+// importPath returns the import path replaced by repository, and
+// whether any pair replaced it.
+func (v *replacerValue) importPath(repository string) (string, bool) {
+	if v.reverse == nil {
+		return "", false
+	}
+	importPath := v.reverse.Replace(repository)
+	return importPath, importPath != repository
+}
+
+func (v *replacerValue) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	return v.Set(str)
+}
+
 func (v *replacerValue) String() string {
 	return "<replacer>"
 }
 
-// GitHub produces Golang import and source URLs suitable for GitHub.
-type GitHub struct {
-	ImportPath string
-	Repository string
-}
+// stringsValue is a flag that may be repeated to build a list.
+type stringsValue []string
 
-// GoImport produces go-import meta tag content for GitHub.
-//
-// See: https://golang.org/cmd/go/#hdr-Remote_import_paths
-func (g GitHub) GoImport() string {
-	return fmt.Sprintf("%s git https://%s.git", g.ImportPath, g.Repository)
+func (v *stringsValue) Set(str string) error {
+	*v = append(*v, str)
+	return nil
 }
 
-// GoSource produces go-source meta tag content for GitHub.
-//
-// See: https://github.com/golang/gddo/wiki/Source-Code-Links
-func (g GitHub) GoSource() string {
-	return fmt.Sprintf("%s _ %s %s",
-		g.ImportPath,
-		fmt.Sprintf("https://%s/blob/master{/dir}", g.Repository),
-		fmt.Sprintf("https://%s/blob/master{/dir}/{file}#L{line}", g.Repository))
+func (v *stringsValue) String() string {
+	return strings.Join(*v, ",")
 }
 
 type nopCloser struct {
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+// BenchmarkRenderPage measures rendering the landing page of a
+// package with the default template.
+func BenchmarkRenderPage(b *testing.B) {
+	vcs, err := newProvider(Repo{ImportPath: "vanity.example.com/foo", Repository: "github.com/actual-user/foo"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := page{
+		ImportPath: "vanity.example.com/foo/bar",
+		Display:    Display{Name: "Bar", Description: "Tools for working with bar."},
+		Docs:       docsURL("vanity.example.com/foo/bar"),
+		VCS:        vcs,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := renderPage(io.Discard, indexTpl, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
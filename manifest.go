@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestDestination records the SHA-256 sum of each file created in
+// its destination, so that a manifest of the output can be written.
+type manifestDestination struct {
+	destination
+	sums map[string]string
+}
+
+func (m *manifestDestination) Create(name string) (io.WriteCloser, error) {
+	w, err := m.destination.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &hashWriter{WriteCloser: w, hash: sha256.New(), done: func(sum string) {
+		m.sums[name] = sum
+	}}, nil
+}
+
+// hashWriter hashes what is written through it, and reports the sum
+// when it is closed.
+type hashWriter struct {
+	io.WriteCloser
+	hash hash.Hash
+	done func(sum string)
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	return w.WriteCloser.Write(p)
+}
+
+func (w *hashWriter) Close() error {
+	w.done(hex.EncodeToString(w.hash.Sum(nil)))
+	return w.WriteCloser.Close()
+}
+
+// writeManifest creates the manifest name, listing the SHA-256 sum of
+// every other file in the output in the format of sha256sum, so that
+// "sha256sum -c" can check it from the output directory. If key names
+// a PEM-encoded Ed25519 private key, a detached signature of the
+// manifest is written beside it with the extension ".sig", which
+// can be checked by the verify command or by:
+//
+//	openssl pkeyutl -verify -pubin -inkey key.pub -rawin \
+//	  -in MANIFEST -sigfile MANIFEST.sig
+func writeManifest(m *manifestDestination, name, key string) error {
+	var names []string
+	for n := range m.sums {
+		if n != name && n != name+".sig" {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, n := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", m.sums[n], n)
+	}
+	if err := writeFile(name, buf.Bytes()); err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+	priv, err := readPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	sig, err := priv.Sign(nil, buf.Bytes(), crypto.Hash(0))
+	if err != nil {
+		return err
+	}
+	return writeFile(name+".sig", sig)
+}
+
+// writeFile creates name in the destination holding b.
+func writeFile(name string, b []byte) error {
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readPrivateKey reads a PEM-encoded PKCS #8 Ed25519 private key, as
+// created by "openssl genpkey -algorithm ed25519".
+func readPrivateKey(name string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", name)
+	}
+	return priv, nil
+}
+
+// readPublicKey reads a PEM-encoded PKIX Ed25519 public key, as
+// created by "openssl pkey -pubout".
+func readPublicKey(name string) (ed25519.PublicKey, error) {
+	block, err := readPEM(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 public key", name)
+	}
+	return pub, nil
+}
+
+// readPEM reads the first PEM block in the file name.
+func readPEM(name string) (*pem.Block, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", name)
+	}
+	return block, nil
+}
+
+// verifyMain implements the verify command, which checks the signature
+// of a manifest and that the files beside it match their sums, as a
+// deployment might before uploading them.
+func verifyMain(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = usage
+	key := fs.String("key", "", "PEM file holding the Ed25519 public key that signed the manifest")
+	fs.Parse(args)
+
+	if *key == "" || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "verify: a -key and the manifest are required")
+		os.Exit(exitUsage)
+	}
+	name := fs.Arg(0)
+
+	pub, err := readPublicKey(*key)
+	exitOnErr(err, exitUsage)
+	manifest, err := os.ReadFile(name)
+	exitOnErr(err, exitLoad)
+	sig, err := os.ReadFile(name + ".sig")
+	exitOnErr(err, exitLoad)
+	if !ed25519.Verify(pub, manifest, sig) {
+		exitOnErr(errors.New(name+": signature does not match"), exitFindings)
+	}
+
+	// Files are named relative to the directory of the manifest.
+	dir := filepath.Dir(name)
+	var bad int
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		sum, file, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			exitOnErr(fmt.Errorf("%s: malformed line %q", name, scanner.Text()), exitFindings)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			fmt.Println(err)
+			bad++
+			continue
+		}
+		if s := sha256.Sum256(b); hex.EncodeToString(s[:]) != sum {
+			fmt.Printf("%s: does not match the manifest\n", file)
+			bad++
+		}
+	}
+	if bad > 0 {
+		os.Exit(exitFindings)
+	}
+}
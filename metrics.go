@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the response
+// latency histogram.
+var latencyBuckets = []float64{.001, .005, .01, .05, .1, .5, 1}
+
+// metrics counts the requests answered by the server, and exposes them
+// in the Prometheus text format.
+type metrics struct {
+	// known are the import paths generated or configured, which
+	// alone are counted by path, so that requests for arbitrary
+	// paths cannot add to the series without bound.
+	known map[string]bool
+
+	mu       sync.Mutex
+	goGet    map[string]int // by import path, or otherPath
+	human    int
+	notFound int
+
+	latencyCounts []int // cumulative, per bucket
+	latencySum    float64
+	latencyCount  int
+}
+
+// otherPath is the import_path label counting requests for paths that
+// are not known.
+const otherPath = "other"
+
+func newMetrics(known map[string]bool) *metrics {
+	return &metrics{
+		known:         known,
+		goGet:         make(map[string]int),
+		latencyCounts: make([]int, len(latencyBuckets)),
+	}
+}
+
+// instrument returns a handler that records the requests answered by h.
+func (m *metrics) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		m.record(r, sw.status, sw.Header().Get("Content-Type"), time.Since(start))
+	})
+}
+
+func (m *metrics) record(r *http.Request, status int, contentType string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case status == http.StatusNotFound:
+		m.notFound++
+	case isGoGet(r):
+		importPath := requestImportPath(r)
+		if !m.known[importPath] {
+			importPath = otherPath
+		}
+		m.goGet[importPath]++
+	case contentType == htmlType:
+		// Pages are only otherwise requested by people, who
+		// are redirected to the documentation.
+		m.human++
+	}
+
+	seconds := d.Seconds()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	fmt.Fprintln(w, "# HELP vanity_go_get_requests_total Requests from the go command, by import path.")
+	fmt.Fprintln(w, "# TYPE vanity_go_get_requests_total counter")
+	paths := make([]string, 0, len(m.goGet))
+	for p := range m.goGet {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(w, "vanity_go_get_requests_total{import_path=\"%s\"} %d\n", labelEscaper.Replace(p), m.goGet[p])
+	}
+
+	fmt.Fprintln(w, "# HELP vanity_redirects_total Pages served to people, who are redirected to documentation.")
+	fmt.Fprintln(w, "# TYPE vanity_redirects_total counter")
+	fmt.Fprintf(w, "vanity_redirects_total %d\n", m.human)
+
+	fmt.Fprintln(w, "# HELP vanity_not_found_total Requests for files that do not exist.")
+	fmt.Fprintln(w, "# TYPE vanity_not_found_total counter")
+	fmt.Fprintf(w, "vanity_not_found_total %d\n", m.notFound)
+
+	fmt.Fprintln(w, "# HELP vanity_response_seconds Time taken to answer requests.")
+	fmt.Fprintln(w, "# TYPE vanity_response_seconds histogram")
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(w, "vanity_response_seconds_bucket{le=\"%g\"} %d\n", le, m.latencyCounts[i])
+	}
+	fmt.Fprintf(w, "vanity_response_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(w, "vanity_response_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(w, "vanity_response_seconds_count %d\n", m.latencyCount)
+}
+
+// labelEscaper escapes a label value in the Prometheus text format,
+// which unlike a Go string escapes only backslashes, double quotes and
+// newlines.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// isGoGet reports whether r was made by the go command looking up an
+// import path.
+func isGoGet(r *http.Request) bool {
+	return r.URL.Query().Get("go-get") == "1"
+}
+
+// requestImportPath returns the import path requested by r.
+func requestImportPath(r *http.Request) string {
+	return strings.TrimSuffix(requestHost(r)+path.Clean("/"+r.URL.Path), "/")
+}
+
+// statusWriter records the status code and number of bytes written to
+// a ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += n
+	return n, err
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// migration is a vanity domain being renamed, as given to -migrate, or
+// an import path being renamed, as given in the moved paths of the
+// configuration.
+type migration struct {
+	Old, New string
+}
+
+// migrationsValue is a flag that may be repeated to rename several
+// domains, each as old=new.
+type migrationsValue []migration
+
+func (v *migrationsValue) Set(str string) error {
+	old, new, ok := strings.Cut(str, "=")
+	if !ok || old == "" || new == "" || strings.Contains(old, "/") || strings.Contains(new, "/") {
+		return fmt.Errorf("invalid %q: expected old=new domains", str)
+	}
+	pair, err := asciiDomains([]string{old, new})
+	if err != nil {
+		return err
+	}
+	*v = append(*v, migration{Old: pair[0], New: pair[1]})
+	return nil
+}
+
+func (v *migrationsValue) String() string {
+	var pairs []string
+	for _, m := range *v {
+		pairs = append(pairs, m.Old+"="+m.New)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// migrations returns the renames of domains and paths to importPath,
+// or a path above it.
+func migrations(importPath string) []migration {
+	var ms []migration
+	for _, m := range migrateFlag {
+		if importPath == m.New || strings.HasPrefix(importPath, m.New+"/") {
+			ms = append(ms, m)
+		}
+	}
+	for old, new := range config.Moved {
+		if importPath == new || strings.HasPrefix(importPath, new+"/") {
+			ms = append(ms, migration{Old: old, New: new})
+		}
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Old < ms[j].Old })
+	return ms
+}
+
+// movedPage returns the page published at the old path of p renamed by
+// m. Its meta tags lead the go command to the same repository under the
+// old path, while people are told of the new one and sent to its
+// documentation.
+func movedPage(p page, m migration) page {
+	p.MovedTo = p.ImportPath
+	p.ImportPath = m.Old + strings.TrimPrefix(p.ImportPath, m.New)
+	p.VCS = prefixOverride{Provider: p.VCS, old: m.New, new: m.Old}
+	return p
+}
+
+// prefixOverride replaces the start of the import path prefix in the
+// meta tag content of a Provider.
+type prefixOverride struct {
+	Provider
+	old, new string
+}
+
+func (o prefixOverride) replace(content string) string {
+	f := strings.Fields(content)
+	if len(f) > 0 && (f[0] == o.old || strings.HasPrefix(f[0], o.old+"/")) {
+		f[0] = o.new + strings.TrimPrefix(f[0], o.old)
+	}
+	return strings.Join(f, " ")
+}
+
+func (o prefixOverride) GoImport() string { return o.replace(o.Provider.GoImport()) }
+func (o prefixOverride) GoSource() string { return o.replace(o.Provider.GoSource()) }
+func (o prefixOverride) unwrap() Provider { return o.Provider }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// moduleStats summarize the size of a module, as shown on the domain
+// index with -stats.
+type moduleStats struct {
+	// Packages is the number of directories in the module holding
+	// Go files, excluding nested modules.
+	Packages int
+
+	// Dependencies is the number of modules required directly,
+	// from go.mod requirements not marked "// indirect".
+	Dependencies int
+}
+
+// moduleStats returns the statistics of the module.
+func (r repository) moduleStats() (*moduleStats, error) {
+	dir := filepath.Join(r.SrcDir, filepath.FromSlash(r.Dir))
+	var s moduleStats
+
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// The go command ignores these directories, and
+			// nested modules are counted separately.
+			base := info.Name()
+			if name != dir && (base == "testdata" || base == "vendor" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+				return filepath.SkipDir
+			}
+			if name != dir {
+				if _, err := os.Stat(filepath.Join(name, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+
+			if hasGoFiles(name) {
+				s.Packages++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Dependencies, err = directDependencies(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// hasGoFiles reports whether dir holds any Go files other than tests.
+func hasGoFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTestFiles reports whether dir holds any Go test files, including
+// those holding only examples.
+func hasTestFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// directDependencies returns the number of requirements in the go.mod
+// file name that are not marked indirect. A missing file has none.
+func directDependencies(name string) (int, error) {
+	mod, err := readGoMod(name)
+	if mod == nil {
+		return 0, err
+	}
+
+	var n int
+	for _, req := range mod.Require {
+		if !req.Indirect {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// dest receives the generated files. If it is nil, pages are written
+// to standard output and other files are not generated.
+var dest destination
+
+// destination stores generated files.
+type destination interface {
+	// Create creates the file with the slash-separated name.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// dirDestination stores files beneath a local directory. A file whose
+// content is unchanged is left untouched, keeping its modification time
+// so that tools such as "aws s3 sync" upload only the files that
+// changed since the last run.
+type dirDestination string
+
+func (d dirDestination) Create(name string) (io.WriteCloser, error) {
+	// Ensure the directory tree exists.
+	name = filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	return &dirFile{name: name}, nil
+}
+
+// dirFile buffers a file written to a dirDestination, and writes it
+// when closed if its content has changed.
+type dirFile struct {
+	name string
+	bytes.Buffer
+}
+
+func (f *dirFile) Close() error {
+	if old, err := os.ReadFile(f.name); err == nil && bytes.Equal(old, f.Bytes()) {
+		stats.keep()
+		return nil
+	}
+	return os.WriteFile(f.name, f.Bytes(), 0666)
+}
+
+// memDestination stores files in memory, keyed by name.
+type memDestination map[string]*bytes.Buffer
+
+func (m memDestination) Create(name string) (io.WriteCloser, error) {
+	buf := new(bytes.Buffer)
+	m[name] = buf
+	return NopCloser(buf), nil
+}
+
+// multiWriteCloser duplicates writes to each of its writers, and
+// closes them all.
+type multiWriteCloser []io.WriteCloser
+
+func (m multiWriteCloser) Write(p []byte) (int, error) {
+	for _, w := range m {
+		if _, err := w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (m multiWriteCloser) Close() error {
+	var first error
+	for _, w := range m {
+		if err := w.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
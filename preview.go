@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// previewMain implements the preview command, which serves a directory
+// of generated files locally as a static host would, so that pages can
+// be checked before they are deployed.
+//
+// With -watch, the arguments after "--" are options and packages for
+// generating the files, which are generated again whenever a file they
+// name changes, and open pages are reloaded.
+func previewMain(args []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	fs.Usage = usage
+	dir := fs.String("dir", ".", "output directory to serve")
+	kv := fs.String("kv", "", "serve the files in this export written by -kv, instead of -dir")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	domain := fs.String("domain", "", "domain served to requests for hosts without files, such as localhost (default: the only domain in -dir)")
+	fs.StringVar(&goGetPage, "go-get-page", "", "page served to requests with ?go-get=1, if they were generated with -go-get-page")
+	watch := fs.Bool("watch", false, "generate the files into -dir from the options and packages following --, and again whenever the templates, configuration, input or assets they name change, reloading open pages")
+	fs.Parse(args)
+
+	// Previews change with each run, so nothing is cached.
+	for class := range cacheControlFlag {
+		cacheControlFlag[class] = "no-store"
+	}
+
+	h := &previewHandler{domain: *domain, reload: *watch, read: readDir}
+	src := *dir
+	if *kv != "" {
+		if *watch {
+			exitOnErr(fmt.Errorf("preview: -watch cannot be used with -kv"), exitUsage)
+		}
+		h.read, src = readKV, *kv
+	}
+	if *watch {
+		w := newWatcher(*dir, fs.Args())
+		if err := w.generate(); err != nil {
+			exitOnErr(err, exitLoad)
+		}
+		go w.run(func() {
+			if err := h.load(*dir); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		})
+	}
+	err := h.load(src)
+	exitOnErr(err, exitLoad)
+
+	fmt.Fprintf(os.Stderr, "serving %s on http://%s/\n", h.domain, *addr)
+	err = http.ListenAndServe(*addr, h)
+	exitOnErr(err, exitError)
+}
+
+// previewHandler serves the files read from a directory.
+type previewHandler struct {
+	mu      sync.RWMutex
+	files   memHandler
+	known   map[string]bool
+	domain  string
+	version int
+
+	// read reads the files to serve, from a directory or an export.
+	read func(string) (memHandler, error)
+
+	// reload is set when pages should reload themselves once the
+	// files are read again.
+	reload bool
+}
+
+// reloadPath is polled by pages for the version of the files, and
+// reloaded when it changes.
+const reloadPath = "/_vanity/version"
+
+// reloadScript reloads a page once the version of the files served
+// differs from %d, the version it was served from.
+const reloadScript = `<script>
+setInterval(function() {
+	fetch(%q).then(function(r) { return r.text(); }).then(function(v) {
+		if (v != "%d") location.reload();
+	});
+}, 1000);
+</script>
+`
+
+// load reads the files from src, replacing those served.
+func (h *previewHandler) load(src string) error {
+	files, err := h.read(src)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("preview: no files in %s", src)
+	}
+
+	domains := files.domains()
+	known := make(map[string]bool)
+	for _, d := range domains {
+		known[d] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.domain == "" {
+		if len(domains) != 1 {
+			return fmt.Errorf("preview: %s holds %d domains; choose one with -domain", src, len(domains))
+		}
+		h.domain = domains[0]
+	}
+	h.version++
+	if h.reload {
+		script := []byte(fmt.Sprintf(reloadScript, reloadPath, h.version))
+		for name, buf := range files {
+			if path.Ext(name) != ".html" {
+				continue
+			}
+			b := buf.Bytes()
+			if i := bytes.LastIndex(b, []byte("</body>")); i >= 0 {
+				files[name] = bytes.NewBuffer(append(append(append([]byte(nil), b[:i]...), script...), b[i:]...))
+			}
+		}
+	}
+	h.files, h.known = files, known
+	return nil
+}
+
+func (h *previewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	files, known, domain, version := h.files, h.known, h.domain, h.version
+	h.mu.RUnlock()
+
+	if h.reload && r.URL.Path == reloadPath {
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, version)
+		return
+	}
+
+	// Requests name the local address rather than the domain,
+	// unless they set the Host header.
+	if !known[requestHost(r)] {
+		r.Host = domain
+	}
+	files.ServeHTTP(w, r)
+}
+
+// readDir reads the files beneath dir into memory, named by their
+// slash-separated paths within it.
+func readDir(dir string) (memHandler, error) {
+	files := make(memDestination)
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		w, _ := files.Create(filepath.ToSlash(rel))
+		w.Write(b)
+		return nil
+	})
+	return memHandler(files), err
+}
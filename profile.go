@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts the profiles requested by the -cpuprofile and
+// -memprofile flags, and returns a function that stops them and writes
+// them out.
+func startProfiling() (stop func()) {
+	var cpu *os.File
+	if cpuProfileFlag != "" {
+		var err error
+		cpu, err = os.Create(cpuProfileFlag)
+		exitOnErr(err, exitOutput)
+		err = pprof.StartCPUProfile(cpu)
+		exitOnErr(err, exitError)
+	}
+
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			exitOnErr(cpu.Close(), exitOutput)
+		}
+
+		if memProfileFlag != "" {
+			f, err := os.Create(memProfileFlag)
+			exitOnErr(err, exitOutput)
+			defer f.Close()
+
+			// Collect garbage so the profile reflects live memory.
+			runtime.GC()
+			err = pprof.WriteHeapProfile(f)
+			exitOnErr(err, exitOutput)
+		}
+	}
+}
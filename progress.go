@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// progress serializes the messages printed on standard error by the
+// goroutines of a run, so that none is split by another, and with
+// -progress reports the packages resolved and pages written.
+var progress = &progressLog{w: os.Stderr, tty: isTerminal(os.Stderr)}
+
+// progressBarWidth is the number of characters in the progress bar.
+const progressBarWidth = 30
+
+// progressLog prints messages and progress to w. When w is a terminal,
+// progress is a single line redrawn beneath the messages; otherwise it
+// is a line for each page written.
+type progressLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	tty bool
+
+	// show is set by -progress, until the run is done.
+	show bool
+
+	queued, resolved int
+	last             string // the page last written
+	drawn            bool   // whether the progress line is shown
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// logf prints a message on standard error.
+func logf(format string, args ...any) {
+	progress.printf(format, args...)
+}
+
+func (l *progressLog) printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clear()
+	fmt.Fprint(l.w, redact(fmt.Sprintf(format, args...)))
+	l.draw()
+}
+
+// queue records n more packages read from the input.
+func (l *progressLog) queue(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queued += n
+	l.draw()
+}
+
+// resolve records a package resolved to its pages.
+func (l *progressLog) resolve() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resolved++
+	l.draw()
+}
+
+// wrote records the page written for importPath, in the repository
+// named by its go-import meta tag content.
+func (l *progressLog) wrote(importPath, goImport string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last = importPath
+	if l.show && !l.tty {
+		fmt.Fprintf(l.w, "%s\t%s\n", importPath, redact(goImport))
+		return
+	}
+	l.draw()
+}
+
+// done removes the progress line, once the run is done or failed.
+func (l *progressLog) done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clear()
+	l.show = false
+}
+
+func (l *progressLog) clear() {
+	if l.drawn {
+		fmt.Fprint(l.w, "\r\x1b[K")
+		l.drawn = false
+	}
+}
+
+func (l *progressLog) draw() {
+	if !l.show || !l.tty {
+		return
+	}
+	n := 0
+	if l.queued > 0 {
+		n = progressBarWidth * l.resolved / l.queued
+	}
+	fmt.Fprintf(l.w, "\r\x1b[K[%s%s] %d/%d %s",
+		strings.Repeat("=", n), strings.Repeat(" ", progressBarWidth-n),
+		l.resolved, l.queued, l.last)
+	l.drawn = true
+}
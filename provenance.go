@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// provenanceFile is the name of the file written by -provenance at the
+// root of the output directory.
+const provenanceFile = "_vanity.json"
+
+// provenance records which run of vanity produced the output, so that
+// operators can tell which deployment is being served.
+type provenance struct {
+	// Version is the version of vanity, and Revision the commit it
+	// was built from, if known.
+	Version  string `json:"version"`
+	Revision string `json:"revision,omitempty"`
+	Go       string `json:"go"`
+
+	Generated time.Time `json:"generated"`
+
+	// Config is the SHA-256 sum of the -config file, if one was
+	// given.
+	Config string `json:"config,omitempty"`
+
+	Domains  []string `json:"domains"`
+	Mappings int      `json:"mappings"`
+}
+
+// writeProvenance creates provenanceFile in the output directory,
+// describing the run that wrote the pages in written.
+func writeProvenance(written map[string]bool) (err error) {
+	p := provenance{
+		Version:   "(devel)",
+		Go:        runtime.Version(),
+		Generated: time.Now().UTC().Truncate(time.Second),
+		Domains:   domains(written),
+		Mappings:  len(written),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			p.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				p.Revision = s.Value
+			}
+		}
+	}
+	if configFlag != "" {
+		b, err := os.ReadFile(configFlag)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		p.Config = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	w, err := create(provenanceFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Provider produces the metadata for a repository hosted by a
+// particular source code hosting service.
+type Provider interface {
+	// GoImport produces go-import meta tag content.
+	//
+	// See: https://golang.org/cmd/go/#hdr-Remote_import_paths
+	GoImport() string
+
+	// GoSource produces go-source meta tag content, or an empty
+	// string if the repository cannot be browsed.
+	//
+	// See: https://github.com/golang/gddo/wiki/Source-Code-Links
+	GoSource() string
+
+	// Releases produces the URL of the repository's release notes,
+	// or an empty string if there are none.
+	Releases() string
+}
+
+// Repo identifies a repository and the module within it served by a
+// Provider.
+type Repo struct {
+	// ImportPath is the import path of the repository.
+	ImportPath string
+
+	// Repository is the host and path of the repository, such as
+	// "github.com/user/repo".
+	Repository string
+
+	// Dir is the slash-separated path of a module within the
+	// repository, or empty if the module is at the root.
+	Dir string
+
+	// Branch is the branch that source links refer to, or empty
+	// for "master".
+	Branch string
+}
+
+// branch returns the branch that source links refer to.
+func (r Repo) branch() string {
+	if r.Branch == "" {
+		return "master"
+	}
+	return r.Branch
+}
+
+// providers construct each Provider by the name used in configuration.
+var providers = map[string]func(Repo) Provider{
+	"cgit":      func(r Repo) Provider { return Cgit{r} },
+	"github":    func(r Repo) Provider { return GitHub{r} },
+	"gitlab":    func(r Repo) Provider { return GitLab{r} },
+	"gitweb":    func(r Repo) Provider { return Gitweb{r} },
+	"launchpad": func(r Repo) Provider { return Launchpad{r} },
+}
+
+// newProvider returns a Provider for the repository r, referring to it
+// over SSH if configured, or otherwise over HTTP with -insecure.
+func newProvider(r Repo) (Provider, error) {
+	p, err := hostProvider(r)
+	if err != nil {
+		return nil, err
+	}
+	if protocol(r) == protocolSSH {
+		p = sshProvider{p}
+	}
+	if insecureFlag {
+		p = insecureProvider{p}
+	}
+	return p, nil
+}
+
+// hostProvider returns the Provider chosen for the repository r.
+//
+// Modules configured to be served from a proxy use it. Otherwise, the
+// provider is chosen by the configuration for the import path or for
+// the host of the repository, or else recognised from the host's
+// name, falling back to GitHub.
+func hostProvider(r Repo) (Provider, error) {
+	pc := config.Lookup(r.ImportPath)
+	if pc.Proxy != nil {
+		u, err := pc.Proxy.proxyURL()
+		if err != nil {
+			return nil, err
+		}
+		return Proxy{Repo: r, url: u}, nil
+	}
+
+	host, _, _ := strings.Cut(r.Repository, "/")
+	hc := config.Hosts[host]
+	if pc.HostConfig.isSet() && !config.mirrored(r.ImportPath) {
+		hc = pc.HostConfig
+	}
+	switch {
+	case len(hc.Command) > 0:
+		return commandProvider(hc.Command, r)
+	case hc.Templates != nil:
+		return templateProvider(*hc.Templates, r)
+	}
+
+	name := hc.Provider
+	if name == "" {
+		switch {
+		case host == "gitlab.com", strings.HasPrefix(host, "gitlab."):
+			name = "gitlab"
+		case host == "launchpad.net", host == "git.launchpad.net":
+			name = "launchpad"
+		default:
+			name = "github"
+		}
+	}
+	return providers[name](r), nil
+}
+
+// vcsOverride replaces the version control system named in the
+// go-import meta tag content of a Provider.
+type vcsOverride struct {
+	Provider
+	vcs string
+}
+
+func (v vcsOverride) GoImport() string {
+	f := strings.Fields(v.Provider.GoImport())
+	if len(f) >= 3 {
+		f[1] = v.vcs
+	}
+	return strings.Join(f, " ")
+}
+
+func (v vcsOverride) unwrap() Provider { return v.Provider }
+
+// sourceOverride replaces the go-source meta tag content of a Provider.
+type sourceOverride struct {
+	Provider
+	goSource string
+}
+
+func (s sourceOverride) GoSource() string { return s.goSource }
+func (s sourceOverride) unwrap() Provider { return s.Provider }
+
+// goSource formats go-source meta tag content for a module at dir
+// within a repository whose directories are browsed from dirBase and
+// files from fileBase.
+func goSource(importPath, dir, dirBase, fileBase string) string {
+	// A module in a subdirectory has its own prefix, and its
+	// directories are relative to that subdirectory.
+	if dir != "" {
+		importPath += "/" + dir
+		dirBase += "/" + dir
+		fileBase += "/" + dir
+	}
+	return fmt.Sprintf("%s _ %s %s",
+		importPath,
+		dirBase+"{/dir}",
+		fileBase+"{/dir}/{file}#L{line}")
+}
+
+// GitHub produces Golang import and source URLs suitable for GitHub.
+type GitHub struct {
+	Repo
+}
+
+// GoImport produces go-import meta tag content for GitHub.
+func (g GitHub) GoImport() string {
+	return fmt.Sprintf("%s git https://%s.git", g.ImportPath, g.Repository)
+}
+
+// GoSource produces go-source meta tag content for GitHub.
+func (g GitHub) GoSource() string {
+	base := fmt.Sprintf("https://%s/blob/%s", g.Repository, g.branch())
+	return goSource(g.ImportPath, g.Dir, base, base)
+}
+
+// Releases produces the URL of the GitHub releases page.
+func (g GitHub) Releases() string {
+	return fmt.Sprintf("https://%s/releases", g.Repository)
+}
+
+// GitLab produces Golang import and source URLs suitable for GitLab.
+type GitLab struct {
+	Repo
+}
+
+// GoImport produces go-import meta tag content for GitLab.
+func (g GitLab) GoImport() string {
+	return fmt.Sprintf("%s git https://%s.git", g.ImportPath, g.Repository)
+}
+
+// GoSource produces go-source meta tag content for GitLab.
+func (g GitLab) GoSource() string {
+	return goSource(g.ImportPath, g.Dir,
+		fmt.Sprintf("https://%s/-/tree/%s", g.Repository, g.branch()),
+		fmt.Sprintf("https://%s/-/blob/%s", g.Repository, g.branch()))
+}
+
+// Releases produces the URL of the GitLab releases page.
+func (g GitLab) Releases() string {
+	return fmt.Sprintf("https://%s/-/releases", g.Repository)
+}
+
+// Cgit produces Golang import and source URLs suitable for cgit, where
+// each repository is browsed at https://<host>/<repository>.
+type Cgit struct {
+	Repo
+}
+
+// GoImport produces go-import meta tag content for cgit.
+func (c Cgit) GoImport() string {
+	return fmt.Sprintf("%s git https://%s", c.ImportPath, c.Repository)
+}
+
+// GoSource produces go-source meta tag content for cgit.
+func (c Cgit) GoSource() string {
+	importPath, tree := c.ImportPath, fmt.Sprintf("https://%s/tree", c.Repository)
+	if c.Dir != "" {
+		importPath += "/" + c.Dir
+		tree += "/" + c.Dir
+	}
+	return fmt.Sprintf("%s _ %s %s",
+		importPath,
+		tree+"{/dir}?h="+c.branch(),
+		tree+"{/dir}/{file}?h="+c.branch()+"#n{line}")
+}
+
+// Releases produces the URL of the cgit refs page, listing tags.
+func (c Cgit) Releases() string {
+	return fmt.Sprintf("https://%s/refs/", c.Repository)
+}
+
+// Gitweb produces Golang import and source URLs suitable for gitweb,
+// where repositories are browsed at https://<host>/?p=<path>.git and
+// cloned from https://<host>/<path>.git.
+type Gitweb struct {
+	Repo
+}
+
+// GoImport produces go-import meta tag content for gitweb.
+func (g Gitweb) GoImport() string {
+	return fmt.Sprintf("%s git https://%s.git", g.ImportPath, g.Repository)
+}
+
+// GoSource produces go-source meta tag content for gitweb.
+func (g Gitweb) GoSource() string {
+	host, project, _ := strings.Cut(g.Repository, "/")
+	base := fmt.Sprintf("https://%s/?p=%s.git", host, project)
+
+	// Directories are given as a parameter, so a module's
+	// directory is prepended to it.
+	importPath, dir := g.ImportPath, "{dir}"
+	if g.Dir != "" {
+		importPath += "/" + g.Dir
+		dir = g.Dir + "{/dir}"
+	}
+	return fmt.Sprintf("%s _ %s %s",
+		importPath,
+		base+";a=tree;f="+dir+";hb="+g.branch(),
+		base+";a=blob;f="+dir+"/{file};hb="+g.branch()+"#l{line}")
+}
+
+// Releases produces the URL of the gitweb tags page.
+func (g Gitweb) Releases() string {
+	host, project, _ := strings.Cut(g.Repository, "/")
+	return fmt.Sprintf("https://%s/?p=%s.git;a=tags", host, project)
+}
+
+// Launchpad produces Golang import and source URLs suitable for
+// Launchpad. Repositories on git.launchpad.net use git, and are browsed
+// with cgit; those on launchpad.net use Bazaar, and have no source
+// links.
+type Launchpad struct {
+	Repo
+}
+
+// git reports whether the repository uses git rather than Bazaar.
+func (l Launchpad) git() bool {
+	return strings.HasPrefix(l.Repository, "git.launchpad.net/")
+}
+
+// GoImport produces go-import meta tag content for Launchpad.
+func (l Launchpad) GoImport() string {
+	if l.git() {
+		return fmt.Sprintf("%s git https://%s", l.ImportPath, l.Repository)
+	}
+	return fmt.Sprintf("%s bzr https://%s", l.ImportPath, l.Repository)
+}
+
+// GoSource produces go-source meta tag content for Launchpad, or an
+// empty string for Bazaar repositories.
+func (l Launchpad) GoSource() string {
+	if !l.git() {
+		return ""
+	}
+	return Cgit(l).GoSource()
+}
+
+// Releases produces the URL of the project's downloads page on
+// Launchpad.
+func (l Launchpad) Releases() string {
+	_, project, _ := strings.Cut(l.Repository, "/")
+	project, _, _ = strings.Cut(project, "/")
+	return fmt.Sprintf("https://launchpad.net/%s/+download", project)
+}
+
+// topicsProvider is implemented by providers that can look up the
+// topics of a repository.
+type topicsProvider interface {
+	Topics() ([]string, error)
+}
+
+// wrappedProvider is implemented by providers that override some of
+// the methods of another.
+type wrappedProvider interface {
+	unwrap() Provider
+}
+
+// baseProvider returns the provider that p wraps, through any number
+// of overrides, so that its optional methods can be found.
+func baseProvider(p Provider) Provider {
+	for {
+		w, ok := p.(wrappedProvider)
+		if !ok {
+			return p
+		}
+		p = w.unwrap()
+	}
+}
+
+// Topics fetches the topics of the repository from the GitHub API,
+// authenticating with $GITHUB_TOKEN if it is set.
+func (g GitHub) Topics() ([]string, error) {
+	_, name, _ := strings.Cut(g.Repository, "/")
+	var body struct {
+		Names []string `json:"names"`
+	}
+	err := getJSON("https://api.github.com/repos/"+name+"/topics", "Authorization", bearer(os.Getenv("GITHUB_TOKEN")), &body)
+	return body.Names, err
+}
+
+// Topics fetches the topics of the project from the GitLab API,
+// authenticating with $GITLAB_TOKEN if it is set.
+func (g GitLab) Topics() ([]string, error) {
+	host, name, _ := strings.Cut(g.Repository, "/")
+	var body struct {
+		Topics []string `json:"topics"`
+	}
+	err := getJSON("https://"+host+"/api/v4/projects/"+url.PathEscape(name), "PRIVATE-TOKEN", os.Getenv("GITLAB_TOKEN"), &body)
+	return body.Topics, err
+}
+
+// apiClient is used for requests to provider APIs.
+var apiClient = &http.Client{Timeout: 30 * time.Second}
+
+// getJSON decodes the JSON response from rawurl into v. If value is
+// not empty, it is sent in the named request header.
+func getJSON(rawurl, header, value string, v interface{}) error {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", rawurl, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// bearer formats token as a bearer token, or returns an empty string if
+// there is no token.
+func bearer(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "Bearer " + token
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ProxyConfig points the modules beneath a path at a Go module proxy,
+// such as an Artifactory or Nexus Go repository, rather than at their
+// version control repositories.
+type ProxyConfig struct {
+	// Type is the software serving the proxy: "artifactory",
+	// "nexus" or "goproxy" for any other.
+	Type string `json:"type"`
+
+	// URL is the base URL of the proxy. For Artifactory and Nexus,
+	// the address of the repository in their web interfaces is
+	// also accepted.
+	URL string `json:"url"`
+}
+
+// proxyURL returns the URL to which the go command should send proxy
+// requests, correcting the forms of URL that Artifactory and Nexus
+// show but do not serve the proxy protocol from.
+func (p ProxyConfig) proxyURL() (string, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("proxy URL %q is not HTTP", p.URL)
+	}
+
+	switch p.Type {
+	case "artifactory":
+		// Go repositories are served beneath api/go, not at
+		// /artifactory/<key> as shown in the interface.
+		base, key, ok := strings.Cut(strings.Trim(u.Path, "/"), "/")
+		if !ok || base != "artifactory" {
+			return "", fmt.Errorf("artifactory URL %q does not name a repository", p.URL)
+		}
+		if !strings.HasPrefix(key, "api/go/") {
+			key = "api/go/" + key
+		}
+		u.Path = "/artifactory/" + key
+	case "nexus":
+		// The interface addresses repositories in the fragment,
+		// as #browse/browse:<name>.
+		if name, ok := strings.CutPrefix(u.Fragment, "browse/browse:"); ok {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/repository/" + name
+			u.Fragment = ""
+		}
+		if !strings.Contains(u.Path, "/repository/") {
+			return "", fmt.Errorf("nexus URL %q does not name a repository", p.URL)
+		}
+	case "goproxy":
+	default:
+		return "", fmt.Errorf("unknown proxy type %q", p.Type)
+	}
+
+	// The go command appends paths beginning with a slash, so a
+	// trailing slash would leave an empty path element, which
+	// these products reject.
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// Proxy serves modules from a Go module proxy, using the "mod" form of
+// the go-import meta tag. There are no source links, as the proxy only
+// holds module archives.
+type Proxy struct {
+	Repo
+	url string
+}
+
+func (p Proxy) GoImport() string {
+	return fmt.Sprintf("%s mod %s", p.ImportPath, p.url)
+}
+
+func (p Proxy) GoSource() string { return "" }
+func (p Proxy) Releases() string { return "" }
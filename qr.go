@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// qrContents produce the text encoded in QR codes for each value of
+// -qr, given a page.
+var qrContents = map[string]func(p page) string{
+	"docs": func(p page) string { return p.Docs },
+	"get":  func(p page) string { return "go get " + p.ImportPath },
+}
+
+// writeQR creates a PNG image of a QR code for p at
+// qr/<importPath>.png beneath its domain, so that it is served from the
+// domain itself.
+func writeQR(p page) (err error) {
+	code, err := qr.Encode(qrContents[qrFlag](p), qr.M)
+	if err != nil {
+		return err
+	}
+
+	domain, _, _ := strings.Cut(p.ImportPath, "/")
+	w, err := create(domain + "/qr/" + p.ImportPath + ".png")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = w.Write(code.PNG())
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// restrictedMaxFile is the largest file that may be written with
+// -restricted.
+const restrictedMaxFile = 1 << 20
+
+// restrict prepares a run with -restricted, for templates and
+// configuration from a source that is not trusted, such as a shared
+// repository generated from in CI. Templates may then neither fetch
+// other hosts, through which they could send what they read, nor run
+// commands, and no file written may exceed restrictedMaxFile.
+func restrict() {
+	templateFuncs["integrity"] = func(url string) (string, error) {
+		if _, ok := localAsset(url); !ok {
+			return "", fmt.Errorf("integrity %q: only assets copied by -assets are allowed with -restricted", url)
+		}
+		return integrity(url)
+	}
+	if dest != nil {
+		// Exports listing the other files grow with them, and
+		// are not rendered from templates.
+		exempt := map[string]bool{kvFlag: true, kubernetesFlag: true, manifestFlag: true}
+		dest = limitDestination{destination: dest, max: restrictedMaxFile, exempt: exempt}
+	}
+}
+
+// limitDestination fails to write any file larger than max bytes,
+// other than those exempt.
+type limitDestination struct {
+	destination
+	max    int64
+	exempt map[string]bool
+}
+
+func (l limitDestination) Create(name string) (io.WriteCloser, error) {
+	w, err := l.destination.Create(name)
+	if err != nil || l.exempt[name] {
+		return w, err
+	}
+	return &limitWriter{WriteCloser: w, name: name, n: l.max, max: l.max}, nil
+}
+
+// limitWriter counts down the bytes left to write to a file.
+type limitWriter struct {
+	io.WriteCloser
+	name   string
+	n, max int64
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.n {
+		return 0, fmt.Errorf("%s: larger than %d bytes, the limit with -restricted", w.name, w.max)
+	}
+	w.n -= int64(len(p))
+	return w.WriteCloser.Write(p)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"html/template"
+	"sort"
+)
+
+// Retirement describes a module that has been removed, whose path is
+// given a page saying so rather than being left to fail with a 404.
+type Retirement struct {
+	// Reason, if set, explains why the module was removed.
+	Reason string `json:"reason"`
+
+	// Archive, if set, is the repository where the last version of
+	// the module remains, such as "github.com/actual-user/foo". The
+	// page's go-import meta tag sends the go command there, so that
+	// existing importers still build.
+	Archive string `json:"archive"`
+}
+
+// writeRetired creates a page at each retired path in the
+// configuration, unless a page was written there.
+func writeRetired(written map[string]bool) error {
+	paths := make([]string, 0, len(config.Retired))
+	for importPath := range config.Retired {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+
+	for _, importPath := range paths {
+		if written[importPath] {
+			warnf("%s: retired, but a page was generated for it\n", importPath)
+			continue
+		}
+
+		r := config.Retired[importPath]
+		data := struct {
+			ImportPath string
+			Reason     string
+			Archive    string
+			VCS        Provider
+			Scheme     string
+			Lang       string
+			Msg        messages
+		}{
+			ImportPath: importPath,
+			Reason:     r.Reason,
+			Archive:    r.Archive,
+			Scheme:     "https",
+			Lang:       langFlag,
+			Msg:        lookupMessages(langFlag),
+		}
+		if insecureFlag {
+			data.Scheme = "http"
+		}
+		if r.Archive != "" {
+			vcs, err := newProvider(Repo{ImportPath: importPath, Repository: r.Archive})
+			if err != nil {
+				return err
+			}
+			data.VCS = vcs
+		}
+
+		w, err := open(importPath)
+		if err != nil {
+			return err
+		}
+		err = retiredTpl.Execute(w, data)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retiredTpl is the page at a retired path.
+var retiredTpl = template.Must(template.New("retired").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{ printf .Msg.Removed .ImportPath }}</title>
+{{- with .VCS }}
+<meta name="go-import" content="{{ .GoImport }}">
+{{- with .GoSource }}
+<meta name="go-source" content="{{ . }}">
+{{- end }}
+{{- end }}
+</head>
+<body>
+<h1>{{ .ImportPath }}</h1>
+<p><strong>{{ printf .Msg.Removed .ImportPath }}</strong></p>
+{{- with .Reason }}
+<p>{{ . }}</p>
+{{- end }}
+{{- with .Archive }}
+<p>{{ $.Msg.Archived }} <a href="{{ $.Scheme }}://{{ . }}">{{ . }}</a>.</p>
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minPartSize is the smallest part of a multipart upload that S3
+// accepts, other than the last.
+const minPartSize = 5 << 20
+
+var (
+	uploadConcurrencyFlag int
+	uploadPartSizeFlag    int
+	uploadLimitFlag       int
+	s3SSEFlag             string
+	s3KMSKeyFlag          string
+	s3ACLFlag             string
+)
+
+// s3ACLs are the canned ACLs that may be given to objects uploaded to
+// S3.
+var s3ACLs = []string{
+	"private", "public-read", "public-read-write", "authenticated-read",
+	"aws-exec-read", "bucket-owner-read", "bucket-owner-full-control",
+}
+
+// s3Destination uploads files as objects to a bucket through the S3
+// API, which Google Cloud Storage also accepts with HMAC keys.
+type s3Destination struct {
+	client *http.Client
+
+	// endpoint is the URL of the bucket, to which object keys
+	// are appended.
+	endpoint *url.URL
+	prefix   string
+	region   string
+
+	accessKey, secretKey, token string
+
+	// Objects larger than partSize are uploaded in parts, with
+	// at most concurrency of them at once, and all uploads
+	// together at no more than the rate of throttle.
+	partSize    int
+	concurrency int
+	throttle    *throttle
+
+	// sse is the server-side encryption of each object, AES256 or
+	// aws:kms with the key kmsKey, and acl its canned ACL.
+	sse, kmsKey string
+	acl         string
+}
+
+// openS3Backend returns the bucket named by a URL such as
+// s3://bucket/prefix, with the credentials and region given by
+// loadAWSConfig. The region and the endpoint of a compatible service
+// such as MinIO may also be given as query parameters:
+//
+//	s3://bucket/prefix?region=eu-west-1&endpoint=http://localhost:9000
+func openS3Backend(u *url.URL) (destination, error) {
+	cfg, err := loadAWSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("-o %s: %v", u, err)
+	}
+	region := u.Query().Get("region")
+	if region == "" {
+		region = cfg.region
+	}
+	creds := cfg.creds
+	if cfg.roleARN != "" {
+		creds, err = assumeRole(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("-o %s: %v", u, err)
+		}
+	}
+	d, err := newS3Destination(u, "https://"+u.Host+".s3."+region+".amazonaws.com", region,
+		creds.accessKey, creds.secretKey, creds.token)
+	if err != nil {
+		return nil, err
+	}
+
+	d.sse, d.kmsKey, d.acl = s3SSEFlag, s3KMSKeyFlag, s3ACLFlag
+	if d.kmsKey != "" && d.sse == "" {
+		d.sse = "aws:kms"
+	}
+	switch {
+	case d.sse != "" && d.sse != "AES256" && d.sse != "aws:kms":
+		return nil, fmt.Errorf(`-s3-sse %s: must be "AES256" or "aws:kms"`, d.sse)
+	case d.kmsKey != "" && d.sse != "aws:kms":
+		return nil, fmt.Errorf("-s3-kms-key is only used with -s3-sse aws:kms")
+	case d.acl != "" && !contains(s3ACLs, d.acl):
+		return nil, fmt.Errorf("-s3-acl %s: must be one of %s", d.acl, strings.Join(s3ACLs, ", "))
+	}
+	return d, nil
+}
+
+// openGSBackend returns the Google Cloud Storage bucket named by a URL
+// such as gs://bucket/prefix, with the HMAC key read from
+// GS_ACCESS_KEY_ID and GS_SECRET_ACCESS_KEY.
+func openGSBackend(u *url.URL) (destination, error) {
+	return newS3Destination(u, "https://storage.googleapis.com/"+u.Host, "auto",
+		os.Getenv("GS_ACCESS_KEY_ID"), os.Getenv("GS_SECRET_ACCESS_KEY"), "")
+}
+
+func newS3Destination(u *url.URL, endpoint, region, accessKey, secretKey, token string) (*s3Destination, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("-o %s: no bucket", u)
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("-o %s: no credentials", u)
+	}
+	// Other services are addressed by path, as virtual hosts may
+	// not be supported.
+	if e := u.Query().Get("endpoint"); e != "" {
+		endpoint = strings.TrimSuffix(e, "/") + "/" + u.Host
+	}
+	eu, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("-o %s: %v", u, err)
+	}
+	if uploadPartSizeFlag<<20 < minPartSize {
+		return nil, fmt.Errorf("-upload-part-size %d: parts must be at least %d MiB", uploadPartSizeFlag, minPartSize>>20)
+	}
+	if uploadConcurrencyFlag < 1 {
+		return nil, fmt.Errorf("-upload-concurrency %d: at least one part must be uploaded at once", uploadConcurrencyFlag)
+	}
+	d := &s3Destination{
+		client:      &http.Client{Timeout: time.Minute},
+		endpoint:    eu,
+		prefix:      strings.Trim(u.Path, "/"),
+		region:      region,
+		accessKey:   accessKey,
+		secretKey:   secretKey,
+		token:       token,
+		partSize:    uploadPartSizeFlag << 20,
+		concurrency: uploadConcurrencyFlag,
+	}
+	if uploadLimitFlag > 0 {
+		d.throttle = &throttle{rate: float64(uploadLimitFlag) * 1024}
+	}
+	return d, nil
+}
+
+func (d *s3Destination) Create(name string) (io.WriteCloser, error) {
+	return &s3Object{d: d, name: name}, nil
+}
+
+// s3Object buffers an object written to an s3Destination, and uploads
+// it when closed.
+type s3Object struct {
+	d    *s3Destination
+	name string
+	bytes.Buffer
+}
+
+func (o *s3Object) Close() error {
+	return o.d.put(o.name, o.Bytes())
+}
+
+// put uploads b as the object for the file name, with the content type
+// and Cache-Control header it would be served with. An object already
+// holding b is left untouched, as a local file with the same content
+// is.
+func (d *s3Destination) put(name string, b []byte) error {
+	if same, err := d.unchanged(name, b); err != nil {
+		return err
+	} else if same {
+		stats.keep()
+		return nil
+	}
+
+	err := d.upload(name, b)
+	// Buckets whose owner owns every object refuse ACLs but the
+	// default, which is then the effect of any other.
+	var e *s3Error
+	if errors.As(err, &e) && e.Code == "AccessControlListNotSupported" && d.acl != "" {
+		warnf("-s3-acl %s: the bucket's owner enforces its ownership of objects, so no ACL is set\n", d.acl)
+		d.acl = ""
+		err = d.upload(name, b)
+	}
+	return err
+}
+
+// upload uploads b as the object for the file name, in parts if it is
+// larger than d.partSize.
+func (d *s3Destination) upload(name string, b []byte) error {
+	if len(b) > d.partSize {
+		return d.putParts(name, b)
+	}
+	req, err := d.request(http.MethodPut, name, nil, b)
+	if err != nil {
+		return err
+	}
+	d.setHeaders(req, name, b)
+	resp, err := d.do(req, b)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// setHeaders sets the headers of req creating the object for the file
+// name, which holds b.
+func (d *s3Destination) setHeaders(req *http.Request, name string, b []byte) {
+	req.Header.Set("Content-Type", contentType(name))
+	if cc := cacheControlFlag[fileClass(name)]; cc != "" {
+		req.Header.Set("Cache-Control", cc)
+	}
+	// The ETag of an object encrypted with a KMS key is not a sum
+	// of its content, so the sum is also kept as metadata.
+	sum := md5.Sum(b)
+	req.Header.Set("X-Amz-Meta-Md5", hex.EncodeToString(sum[:]))
+	if d.sse != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption", d.sse)
+	}
+	if d.kmsKey != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", d.kmsKey)
+	}
+	if d.acl != "" {
+		req.Header.Set("X-Amz-Acl", d.acl)
+	}
+}
+
+// etagOf returns the ETag of an object holding b, uploaded by put: the
+// MD5 sum of b, or for a multipart upload the MD5 sum of the sums of
+// its parts followed by the number of parts.
+func (d *s3Destination) etagOf(b []byte) string {
+	if len(b) <= d.partSize {
+		sum := md5.Sum(b)
+		return hex.EncodeToString(sum[:])
+	}
+	var sums []byte
+	n := 0
+	for off := 0; off < len(b); off += d.partSize {
+		sum := md5.Sum(b[off:min(off+d.partSize, len(b))])
+		sums = append(sums, sum[:]...)
+		n++
+	}
+	sum := md5.Sum(sums)
+	return hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(n)
+}
+
+// putParts uploads b as the object for the file name in parts of
+// d.partSize bytes, d.concurrency at a time. The upload is aborted if
+// any part fails, so that the parts already stored are not charged for.
+func (d *s3Destination) putParts(name string, b []byte) (err error) {
+	req, err := d.request(http.MethodPost, name, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	d.setHeaders(req, name, b)
+	resp, err := d.do(req, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", req.Method, req.URL, err)
+	}
+	upload := url.Values{"uploadId": {initiated.UploadID}}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if req, rerr := d.request(http.MethodDelete, name, upload, nil); rerr == nil {
+			if resp, rerr := d.do(req, nil); rerr == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var parts []part
+	for off := 0; off < len(b); off += d.partSize {
+		parts = append(parts, part{PartNumber: len(parts) + 1})
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+		sem   = make(chan struct{}, d.concurrency)
+	)
+	for i := range parts {
+		off := i * d.partSize
+		body := b[off:min(off+d.partSize, len(b))]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			etag, err := d.putPart(name, upload, parts[i].PartNumber, body)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && first == nil {
+				first = err
+			}
+			parts[i].ETag = etag
+		}(i)
+	}
+	wg.Wait()
+	if first != nil {
+		return first
+	}
+
+	complete, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	req, err = d.request(http.MethodPost, name, upload, complete)
+	if err != nil {
+		return err
+	}
+	resp, err = d.do(req, complete)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Completion can fail after the response has begun, in which
+	// case its body holds the error.
+	var result struct {
+		XMLName xml.Name
+		Message string
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL, result.Message)
+	}
+	return nil
+}
+
+// putPart uploads b as part n of the upload, and returns its ETag.
+func (d *s3Destination) putPart(name string, upload url.Values, n int, b []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(n)}}
+	for k, v := range upload {
+		query[k] = v
+	}
+	req, err := d.request(http.MethodPut, name, query, b)
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.do(req, b)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// unchanged reports whether the object for the file name already holds
+// b, as shown by the sum of its content kept as metadata, or else by
+// its ETag. An object the credentials may not read is taken to differ,
+// as a missing one is, so that write-only credentials upload every
+// file.
+func (d *s3Destination) unchanged(name string, b []byte) (bool, error) {
+	req, err := d.request(http.MethodHead, name, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := d.do(req, nil)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if sum := resp.Header.Get("X-Amz-Meta-Md5"); sum != "" {
+		s := md5.Sum(b)
+		return sum == hex.EncodeToString(s[:]), nil
+	}
+	return strings.Trim(resp.Header.Get("ETag"), `"`) == d.etagOf(b), nil
+}
+
+// request returns an unsigned request for the object holding the file
+// name, with the query parameters and the body b, which is read no
+// faster than d.throttle allows.
+func (d *s3Destination) request(method, name string, query url.Values, b []byte) (*http.Request, error) {
+	u := *d.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + path.Join(d.prefix, name)
+	u.RawPath = s3Escape(u.Path)
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(b))
+	if err != nil || d.throttle == nil || len(b) == 0 {
+		return req, err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(d.throttle.reader(bytes.NewReader(b))), nil
+	}
+	req.Body, _ = req.GetBody()
+	return req, nil
+}
+
+// do signs and sends req, whose body is b. It returns an *s3Error for
+// any response but success, along with the response itself.
+func (d *s3Destination) do(req *http.Request, b []byte) (*http.Response, error) {
+	if d.token != "" {
+		req.Header.Set("X-Amz-Security-Token", d.token)
+	}
+	sum := sha256.Sum256(b)
+	d.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		e := &s3Error{Method: req.Method, URL: req.URL.String(), Status: resp.Status}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if xml.Unmarshal(msg, e) != nil {
+			e.Message = string(bytes.TrimSpace(msg))
+		}
+		return resp, e
+	}
+	return resp, nil
+}
+
+// s3Error is an error response from S3.
+type s3Error struct {
+	Method, URL, Status string
+
+	// Code and Message are read from the body of the response.
+	Code    string
+	Message string
+}
+
+func (e *s3Error) Error() string {
+	msg := e.Method + " " + e.URL + ": " + e.Status
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// sign signs req with AWS Signature Version 4, given the SHA-256 sum
+// of its body in hexadecimal.
+func (d *s3Destination) sign(req *http.Request, payloadHash string, t time.Time) {
+	signV4(req, "s3", d.region, d.accessKey, d.secretKey, payloadHash, t)
+}
+
+// signV4 signs req to the AWS service in region with AWS Signature
+// Version 4, given the SHA-256 sum of its body in hexadecimal.
+func signV4(req *http.Request, service, region, accessKey, secretKey, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3Escape escapes each byte of p but the unreserved characters and
+// slashes, as Signature Version 4 expects.
+func s3Escape(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes query sorted by key, escaping spaces as %20 rather
+// than "+", as Signature Version 4 expects.
+func s3Query(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// throttle limits the rate at which all uploads together send bytes.
+type throttle struct {
+	rate float64 // bytes per second
+
+	mu   sync.Mutex
+	next time.Time // when the bytes already sent are paid for
+}
+
+// wait blocks until n more bytes may be sent.
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	d := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(float64(n) / t.rate * float64(time.Second)))
+	t.mu.Unlock()
+	time.Sleep(d)
+}
+
+// reader returns a reader of r limited by t.
+func (t *throttle) reader(r io.Reader) io.Reader {
+	return throttledReader{r: r, t: t}
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (r throttledReader) Read(p []byte) (int, error) {
+	// Read in small pieces, so that a large buffer is not sent in a
+	// single burst.
+	if len(p) > 16<<10 {
+		p = p[:16<<10]
+	}
+	n, err := r.r.Read(p)
+	r.t.wait(n)
+	return n, err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// snapshotMain implements the snapshot command, which compares the
+// files that would be generated with golden copies in a directory, so
+// that changes to templates can be checked by a repository's tests:
+//
+//	vanity snapshot -golden testdata/golden \
+//	  -json testdata/packages.json -template page.html
+//
+// With -update, the golden copies are replaced instead, and any no
+// longer generated are removed, so the directory must hold nothing
+// else.
+func snapshotMain(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	fs.Usage = usage
+	addFlags(fs)
+	golden := fs.String("golden", "", "directory holding the golden copy of each generated file")
+	update := fs.Bool("update", false, "replace the golden copies with the generated files")
+	fs.Parse(args)
+
+	if *golden == "" {
+		fmt.Fprintln(os.Stderr, "snapshot: -golden is required")
+		os.Exit(exitUsage)
+	}
+
+	mem := make(memDestination)
+	dest = mem
+	generate(fs.Args())
+
+	want, err := readDir(*golden)
+	if err != nil && !os.IsNotExist(err) {
+		exitOnErr(err, exitLoad)
+	}
+
+	if *update {
+		for name := range want {
+			if _, ok := mem[name]; !ok {
+				err := os.Remove(filepath.Join(*golden, filepath.FromSlash(name)))
+				exitOnErr(err, exitOutput)
+				stats.remove()
+			}
+		}
+		err := copyFiles(dirDestination(*golden), mem)
+		exitOnErr(err, exitOutput)
+		if summaryFlag {
+			stats.print(os.Stderr)
+		}
+		return
+	}
+
+	names := make(map[string]bool)
+	for name := range mem {
+		names[name] = true
+	}
+	for name := range want {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changed int
+	for _, name := range sorted {
+		got, ok := mem[name]
+		wantBuf, wantOK := want[name]
+		var status string
+		switch {
+		case !wantOK:
+			status = "not in golden files"
+		case !ok:
+			status = "no longer generated"
+		case !bytes.Equal(got.Bytes(), wantBuf.Bytes()):
+			status = "differs from golden file"
+		default:
+			continue
+		}
+		fmt.Printf("%s: %s\n", filepath.Join(*golden, filepath.FromSlash(name)), status)
+		changed++
+	}
+
+	if summaryFlag {
+		stats.print(os.Stderr)
+	}
+	if changed > 0 {
+		fmt.Fprintln(os.Stderr, "snapshot: run with -update to accept the changes")
+		os.Exit(exitFindings)
+	}
+}
+
+// copyFiles writes each of the files to d.
+func copyFiles(d destination, files memDestination) error {
+	for name, buf := range files {
+		w, err := d.Create(name)
+		if err != nil {
+			return err
+		}
+		w.Write(buf.Bytes())
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
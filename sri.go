@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// integrityCache holds the Subresource Integrity values of assets
+// already fetched, by URL.
+var integrityCache = struct {
+	sync.Mutex
+	values map[string]string
+}{values: make(map[string]string)}
+
+// integrity returns the Subresource Integrity value of the asset at
+// url, for a template referencing it:
+//
+//	<script src="https://example.com/app.js" integrity="{{ integrity "https://example.com/app.js" }}" crossorigin="anonymous"></script>
+//
+// The asset is fetched once per run, and an asset that cannot be
+// fetched fails generation rather than being left unprotected. Assets
+// copied by -assets are read from their files instead.
+func integrity(url string) (string, error) {
+	if b, ok := localAsset(url); ok {
+		sum := sha512.Sum384(b)
+		return "sha384-" + base64.StdEncoding.EncodeToString(sum[:]), nil
+	}
+
+	integrityCache.Lock()
+	defer integrityCache.Unlock()
+	if v, ok := integrityCache.values[url]; ok {
+		return v, nil
+	}
+
+	resp, err := apiClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	h := sha512.New384()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("fetching %s: %v", url, err)
+	}
+	v := "sha384-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	integrityCache.values[url] = v
+	return v, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// statsMain implements the stats command, which summarizes a directory
+// of generated files, such as one being deployed, without generating
+// them again.
+func statsMain(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Usage = usage
+	dir := fs.String("dir", ".", "output directory to summarize")
+	fs.Parse(args)
+
+	s, err := summarizeTree(*dir)
+	exitOnErr(err, exitLoad)
+	s.print(os.Stdout)
+}
+
+// treeStats summarizes the files in an output directory.
+type treeStats struct {
+	files int
+	size  int64
+	pages int
+
+	// repositories, providers and branches count the pages sending
+	// the go command to each repository, served by each provider
+	// or linking to the source on each branch.
+	repositories map[string]int
+	providers    map[string]int
+	branches     map[string]int
+}
+
+// summarizeTree summarizes the files beneath dir. The landing page of
+// each path is read for the meta tags that the go command would read.
+func summarizeTree(dir string) (*treeStats, error) {
+	s := &treeStats{
+		repositories: make(map[string]int),
+		providers:    make(map[string]int),
+		branches:     make(map[string]int),
+	}
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		s.files++
+		s.size += info.Size()
+
+		// Copies of pages, made by -html-ext and -go-get-page,
+		// are not counted again.
+		if filepath.Base(name) != "index.html" {
+			return nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		goImport, goSource := readMeta(f)
+		imp := strings.Fields(goImport)
+		if len(imp) != 3 {
+			return nil
+		}
+		s.pages++
+		s.repositories[imp[2]]++
+		provider, branch := sourceProvider(imp[1], goSource)
+		s.providers[provider]++
+		if branch != "" {
+			s.branches[branch]++
+		}
+		return nil
+	})
+	return s, err
+}
+
+func (s *treeStats) print(w io.Writer) {
+	fmt.Fprintf(w, "%d files, %d bytes\n", s.files, s.size)
+	fmt.Fprintf(w, "%d pages, %d repositories\n", s.pages, len(s.repositories))
+	for _, c := range []struct {
+		title  string
+		counts map[string]int
+	}{
+		{"pages per repository", s.repositories},
+		{"providers", s.providers},
+		{"branches", s.branches},
+	} {
+		if len(c.counts) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", c.title)
+		for _, key := range byCount(c.counts) {
+			fmt.Fprintf(w, "%6d  %s\n", c.counts[key], key)
+		}
+	}
+}
+
+// byCount returns the keys of counts, most counted first.
+func byCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// readMeta returns the content of the first go-import and go-source
+// meta tags of the page read from r, parsed as the go command parses
+// it.
+func readMeta(r io.Reader) (goImport, goSource string) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			return
+		}
+		switch e := t.(type) {
+		case xml.StartElement:
+			if strings.EqualFold(e.Name.Local, "body") {
+				return
+			}
+			if !strings.EqualFold(e.Name.Local, "meta") {
+				continue
+			}
+			content := attrValue(e.Attr, "content")
+			switch attrValue(e.Attr, "name") {
+			case "go-import":
+				if goImport == "" {
+					goImport = content
+				}
+			case "go-source":
+				if goSource == "" {
+					goSource = content
+				}
+			}
+		case xml.EndElement:
+			if strings.EqualFold(e.Name.Local, "head") {
+				return
+			}
+		}
+	}
+}
+
+// sourceProvider recognises the provider serving a repository with the
+// version control system vcs by the URLs in its go-source meta tag
+// content, and the branch they refer to. Branches are assumed not to
+// contain a slash.
+func sourceProvider(vcs, goSource string) (provider, branch string) {
+	switch vcs {
+	case "mod":
+		return "proxy", ""
+	case "bzr":
+		return "launchpad", ""
+	}
+
+	f := strings.Fields(goSource)
+	if len(f) != 4 {
+		return "other", ""
+	}
+	dir := f[2]
+	for _, p := range []struct {
+		name, marker string
+	}{
+		{"gitlab", "/-/tree/"},
+		{"github", "/blob/"},
+		{"gitweb", ";hb="},
+		{"cgit", "?h="},
+	} {
+		_, rest, ok := strings.Cut(dir, p.marker)
+		if !ok {
+			continue
+		}
+		if i := strings.IndexAny(rest, "/{#;&"); i >= 0 {
+			rest = rest[:i]
+		}
+		name := p.name
+		if name == "cgit" && strings.Contains(dir, "://git.launchpad.net/") {
+			name = "launchpad"
+		}
+		return name, rest
+	}
+	return "other", ""
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mappingStore looks up the repository serving an import path.
+type mappingStore interface {
+	// Get returns the repository for importPath exactly, or an
+	// empty string if it has none.
+	Get(importPath string) (string, error)
+}
+
+// storeHandler serves pages generated from the mappings held in a store,
+// for requests that have no static file.
+type storeHandler struct {
+	static memHandler
+	store  mappingStore
+}
+
+func (h *storeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.static[h.static.file(r)]; ok {
+		h.static.ServeHTTP(w, r)
+		return
+	}
+
+	// Mappings are held for repository roots, and apply to every
+	// package beneath them.
+	importPath := requestImportPath(r)
+	if !config.allowed(importPath) {
+		h.static.ServeHTTP(w, r)
+		return
+	}
+	for root := importPath; ; {
+		repo, err := h.store.Get(root)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "mapping store unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if repo != "" {
+			tpl := indexTpl
+			if goGetPage != "" && isGoGet(r) {
+				tpl = minimalTpl
+			}
+
+			vcs, err := newProvider(Repo{ImportPath: root, Repository: repo})
+			if err != nil {
+				log.Print(err)
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			var buf bytes.Buffer
+			p := page{
+				ImportPath: importPath,
+				Display:    config.Lookup(importPath).Display,
+				Docs:       docsURL(importPath),
+				VCS:        vcs,
+			}
+			if err := renderPage(&buf, tpl, p); err != nil {
+				log.Print(err)
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", htmlType)
+			w.Header().Set("Cache-Control", cacheControlFlag[classPage])
+			w.Write(buf.Bytes())
+			return
+		}
+
+		i := strings.LastIndex(root, "/")
+		if i < 0 {
+			break
+		}
+		root = root[:i]
+	}
+	http.NotFound(w, r)
+}
+
+// multiStore returns the mapping from the first of its stores that has
+// one.
+type multiStore []mappingStore
+
+func (m multiStore) Get(importPath string) (string, error) {
+	for _, s := range m {
+		repo, err := s.Get(importPath)
+		if repo != "" || err != nil {
+			return repo, err
+		}
+	}
+	return "", nil
+}
+
+// prefixStore maps import paths to repositories by patterns, such as
+// "vanity.example.com/*" mapping to "github.com/org/*", where "*"
+// matches a single path element.
+type prefixStore []prefixRule
+
+type prefixRule struct {
+	pattern string
+	repo    string
+}
+
+// parsePrefixRules parses a comma-separated list of pattern=repository
+// pairs.
+func parsePrefixRules(str string) (prefixStore, error) {
+	var rules prefixStore
+	for _, pair := range strings.Split(str, ",") {
+		pattern, repo, ok := strings.Cut(pair, "=")
+		if !ok || strings.Count(pattern, "*") > 1 || strings.Count(repo, "*") != strings.Count(pattern, "*") {
+			return nil, fmt.Errorf("invalid prefix rule %q: expected pattern=repository with matching wildcards", pair)
+		}
+		rules = append(rules, prefixRule{pattern: pattern, repo: repo})
+	}
+	return rules, nil
+}
+
+func (p prefixStore) Get(importPath string) (string, error) {
+	for _, rule := range p {
+		if repo, ok := rule.match(importPath); ok {
+			return repo, nil
+		}
+	}
+	return "", nil
+}
+
+// match returns the repository for importPath if it matches the rule.
+func (r prefixRule) match(importPath string) (string, bool) {
+	want := strings.Split(r.pattern, "/")
+	got := strings.Split(importPath, "/")
+	if len(want) != len(got) {
+		return "", false
+	}
+
+	var wildcard string
+	for i := range want {
+		switch {
+		case want[i] == "*" && got[i] != "":
+			wildcard = got[i]
+		case want[i] != got[i]:
+			return "", false
+		}
+	}
+	return strings.Replace(r.repo, "*", wildcard, 1), true
+}
+
+// cachedStore remembers the mappings read from another store for ttl,
+// and their absence for missTTL, which is kept short so that a path
+// is served soon after its mapping is added. At most size mappings are
+// held, the least recently used being forgotten first, as requests for
+// paths that do not exist would otherwise fill memory.
+type cachedStore struct {
+	store   mappingStore
+	ttl     time.Duration
+	missTTL time.Duration
+	size    int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // of *cacheEntry, most recently used first
+}
+
+type cacheEntry struct {
+	importPath string
+	repo       string
+	expires    time.Time
+}
+
+func (c *cachedStore) Get(importPath string) (string, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if el, ok := c.entries[importPath]; ok {
+		e := el.Value.(*cacheEntry)
+		if now.Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return e.repo, nil
+		}
+		c.lru.Remove(el)
+		delete(c.entries, importPath)
+	}
+	c.mu.Unlock()
+
+	repo, err := c.store.Get(importPath)
+	if err != nil {
+		return "", err
+	}
+	ttl := c.ttl
+	if repo == "" {
+		ttl = c.missTTL
+	}
+	if ttl <= 0 || c.size <= 0 {
+		return repo, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	// Another request may have read the same path meanwhile.
+	if el, ok := c.entries[importPath]; ok {
+		c.lru.Remove(el)
+	}
+	c.entries[importPath] = c.lru.PushFront(&cacheEntry{importPath: importPath, repo: repo, expires: now.Add(ttl)})
+	for c.lru.Len() > c.size {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*cacheEntry).importPath)
+	}
+	return repo, nil
+}
+
+// redisStore reads mappings from Redis, where each key is an import
+// path with a prefix, and its value is the repository.
+type redisStore struct {
+	addr     string
+	username string // for Redis 6 ACLs, or empty for the default user
+	password string
+	db       int
+	prefix   string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRedisStore returns a store for the Redis server at rawurl.
+func newRedisStore(rawurl, prefix string) (*redisStore, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("redis: unsupported scheme %q", u.Scheme)
+	}
+
+	s := &redisStore{addr: u.Host, prefix: prefix}
+	if _, _, err := net.SplitHostPort(s.addr); err != nil {
+		s.addr = net.JoinHostPort(s.addr, "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis: invalid database %q", db)
+		}
+	}
+	return s, nil
+}
+
+func (s *redisStore) Get(importPath string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return "", err
+		}
+	}
+
+	v, err := s.do("GET", s.prefix+importPath)
+	if err != nil {
+		// Reconnect on the next request, in case the connection
+		// is the problem.
+		s.conn.Close()
+		s.conn = nil
+		return "", err
+	}
+	return v, nil
+}
+
+// connect dials the server, then authenticates and selects the database
+// if required.
+func (s *redisStore) connect() error {
+	conn, err := net.DialTimeout("tcp", s.addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn, s.r = conn, bufio.NewReader(conn)
+
+	if s.password != "" {
+		auth := []string{"AUTH", s.password}
+		if s.username != "" {
+			auth = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := s.do(auth...); err != nil {
+			conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	if s.db != 0 {
+		if _, err := s.do("SELECT", strconv.Itoa(s.db)); err != nil {
+			conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a command and returns its reply. A nil reply is returned as
+// an empty string.
+func (s *redisStore) do(args ...string) (string, error) {
+	s.conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		return "", err
+	}
+
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("redis: invalid reply %q", line)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		data := make([]byte, n+2) // including CRLF
+		if _, err := io.ReadFull(s.r, data); err != nil {
+			return "", err
+		}
+		return string(data[:n]), nil
+	default:
+		return "", fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeRedis accepts a single connection on l, recording the commands
+// sent on it and answering each with OK.
+func fakeRedis(l net.Listener) <-chan []string {
+	commands := make(chan []string, 10)
+	go func() {
+		defer close(commands)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := make([]string, n)
+			for i := range args {
+				r.ReadString('\n') // the length
+				arg, _ := r.ReadString('\n')
+				args[i] = strings.TrimSuffix(arg, "\r\n")
+			}
+			commands <- args
+			conn.Write([]byte("+OK\r\n"))
+		}
+	}()
+	return commands
+}
+
+func TestRedisStoreAuth(t *testing.T) {
+	for _, tt := range []struct {
+		userinfo, auth string
+	}{
+		{":hunter22", "AUTH hunter22"},
+		{"vanity:hunter22", "AUTH vanity hunter22"},
+	} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands := fakeRedis(l)
+
+		s, err := newRedisStore("redis://"+tt.userinfo+"@"+l.Addr().String()+"/0", "vanity:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get("vanity.example.com/foo"); err != nil {
+			t.Fatal(err)
+		}
+		s.conn.Close()
+		l.Close()
+
+		if got := strings.Join(<-commands, " "); got != tt.auth {
+			t.Errorf("%s: first command %q, want %q", tt.userinfo, got, tt.auth)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// stats accumulates counts over a single run.
+var stats summary
+
+// summary records what a run has processed and produced. Its counts
+// are added to while paths are both resolved and written, so each is
+// guarded by mu.
+type summary struct {
+	mu       sync.Mutex
+	packages int
+	repos    map[string]bool
+	// skipped counts the packages for which no page is written,
+	// such as those holding only tests.
+	skipped int
+	files   int
+	// unchanged counts the files written with the same content
+	// they already had.
+	unchanged int
+	// deleted counts the files removed as no longer generated.
+	deleted  int
+	errors   int
+	warnings int
+}
+
+// addPackage records a package that resides in the repository at root.
+func (s *summary) addPackage(root string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.repos == nil {
+		s.repos = make(map[string]bool)
+	}
+	s.packages++
+	s.repos[root] = true
+}
+
+// skip records a package for which no page is written.
+func (s *summary) skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped++
+}
+
+// write records a file written.
+func (s *summary) write() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files++
+}
+
+// keep records a file written with the content it already had.
+func (s *summary) keep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unchanged++
+}
+
+// remove records a file removed as no longer generated.
+func (s *summary) remove() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted++
+}
+
+// fail records an error.
+func (s *summary) fail() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+}
+
+// warn records a warning.
+func (s *summary) warn() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warnings++
+}
+
+func (s *summary) print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(w, "%d packages (%d skipped), %d repositories, %d files written (%d unchanged, %d deleted), %d errors, %d warnings\n",
+		s.packages, s.skipped, len(s.repos), s.files, s.unchanged, s.deleted, s.errors, s.warnings)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation.
+const listenFDsStart = 3
+
+// activatedListeners returns the listeners passed by systemd socket
+// activation, keyed by name: the FileDescriptorName of each socket, if
+// set, or else http, https and admin in the order given, as the serve
+// command would otherwise listen on them. It returns nil if the
+// process was not socket-activated.
+func activatedListeners(names []string) (map[string]net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n == 0 {
+		return nil, nil
+	}
+	fdNames := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// The variables are meant for this process only, not its children.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make(map[string]net.Listener, n)
+	for i := 0; i < n; i++ {
+		// systemd names sockets "unknown" unless told otherwise.
+		name := "unknown"
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+		if name == "unknown" || name == "stored" {
+			if i >= len(names) {
+				return nil, fmt.Errorf("socket activation: %d sockets passed, but only %d used", n, len(names))
+			}
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: %s: %v", name, err)
+		}
+		listeners[name] = l
+	}
+	return listeners, nil
+}
+
+// printSystemd writes a socket and service unit to w, running the serve
+// command with args when a request arrives on the addresses of the
+// listeners names, in that order, as activatedListeners expects.
+func printSystemd(w io.Writer, args []string, addrs map[string]string, names []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "# /etc/systemd/system/vanity.socket")
+	fmt.Fprintln(w, "[Unit]")
+	fmt.Fprintln(w, "Description=Vanity import path server sockets")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[Socket]")
+	for _, name := range names {
+		// systemd takes a port alone to mean every address.
+		addr := addrs[name]
+		if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+			addr = port
+		}
+		fmt.Fprintf(w, "ListenStream=%s\n", addr)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[Install]")
+	fmt.Fprintln(w, "WantedBy=sockets.target")
+	fmt.Fprintln(w)
+
+	quoted := []string{systemdQuote(exe), "serve"}
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	fmt.Fprintln(w, "# /etc/systemd/system/vanity.service")
+	fmt.Fprintln(w, "[Unit]")
+	fmt.Fprintln(w, "Description=Vanity import path server")
+	fmt.Fprintln(w, "Requires=vanity.socket")
+	fmt.Fprintln(w, "After=network-online.target")
+	fmt.Fprintln(w, "Wants=network-online.target")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[Service]")
+	fmt.Fprintf(w, "ExecStart=%s\n", strings.Join(quoted, " "))
+	fmt.Fprintln(w, "DynamicUser=yes")
+	fmt.Fprintln(w, "StateDirectory=vanity")
+	fmt.Fprintln(w, "NoNewPrivileges=yes")
+	fmt.Fprintln(w, "ProtectSystem=strict")
+	fmt.Fprintln(w, "ProtectHome=read-only")
+	fmt.Fprintln(w, "PrivateTmp=yes")
+	fmt.Fprintln(w, "Restart=on-failure")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[Install]")
+	_, err = fmt.Fprintln(w, "WantedBy=multi-user.target")
+	return err
+}
+
+// systemdQuote quotes s as a single word on a systemd command line.
+func systemdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$%;") {
+		return s
+	}
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$", "%", "%%").Replace(s)
+	return `"` + s + `"`
+}
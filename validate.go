@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// validateDestination checks each HTML file created in its destination
+// once it is written, recording the problems found by validateHTML.
+type validateDestination struct {
+	destination
+	problems map[string][]string
+}
+
+func (v *validateDestination) Create(name string) (io.WriteCloser, error) {
+	w, err := v.destination.Create(name)
+	if err != nil || path.Ext(name) != ".html" {
+		return w, err
+	}
+	return &validateWriter{WriteCloser: w, done: func(b []byte) {
+		if problems := validateHTML(b); len(problems) > 0 {
+			v.problems[name] = problems
+		}
+	}}, nil
+}
+
+// err returns an error listing the problems found in every file, or nil
+// if there were none.
+func (v *validateDestination) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	var names []string
+	for name := range v.problems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("invalid HTML:")
+	for _, name := range names {
+		for _, p := range v.problems[name] {
+			fmt.Fprintf(&b, "\n\t%s: %s", name, p)
+		}
+	}
+	return fmt.Errorf("%s", b.String())
+}
+
+// validateWriter keeps what is written through it, and passes it on
+// to be checked when it is closed.
+type validateWriter struct {
+	io.WriteCloser
+	buf  bytes.Buffer
+	done func(b []byte)
+}
+
+func (w *validateWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	return w.WriteCloser.Write(p)
+}
+
+func (w *validateWriter) Close() error {
+	w.done(w.buf.Bytes())
+	return w.WriteCloser.Close()
+}
+
+// voidElements are the HTML elements that have no end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// validateHTML describes the problems with the page b, beyond those
+// reported by lintPage.
+//
+// Browsers repair almost any page, but the go command reads the meta
+// tags as XML, so a page is held to a stricter standard: every element
+// other than a void element is closed explicitly and in order, there is
+// exactly one head, and every meta tag is inside it.
+func validateHTML(b []byte) []string {
+	problems := lintPage(bytes.NewReader(b))
+
+	var (
+		open  []string // elements not yet closed, innermost last
+		heads int
+	)
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				problems = append(problems, fmt.Sprintf("parse error: %v", err))
+			}
+			break
+		}
+
+		t := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch t.Data {
+			case "head":
+				heads++
+			case "meta":
+				if !contains(open, "head") {
+					problems = append(problems, "meta tag outside head")
+				}
+			}
+			if tt == html.StartTagToken && !voidElements[t.Data] {
+				open = append(open, t.Data)
+			}
+		case html.EndTagToken:
+			if voidElements[t.Data] {
+				problems = append(problems, fmt.Sprintf("end tag </%s> of a void element", t.Data))
+				continue
+			}
+			if len(open) == 0 || open[len(open)-1] != t.Data {
+				want := "no end tag"
+				if len(open) > 0 {
+					want = fmt.Sprintf("</%s>", open[len(open)-1])
+				}
+				problems = append(problems, fmt.Sprintf("unexpected </%s>, want %s", t.Data, want))
+				// Resynchronize with the element being
+				// closed, if it is open at all.
+				for i := len(open) - 1; i >= 0; i-- {
+					if open[i] == t.Data {
+						open = open[:i]
+						break
+					}
+				}
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		problems = append(problems, fmt.Sprintf("<%s> is not closed", open[i]))
+	}
+	if heads != 1 {
+		problems = append(problems, fmt.Sprintf("%d head elements, want 1", heads))
+	}
+	return problems
+}
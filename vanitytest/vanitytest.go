@@ -0,0 +1,174 @@
+/*
+Package vanitytest checks the files vanity generates against golden
+copies, so that a repository customizing the built-in templates, or
+giving its own with -template, can test its changes:
+
+	func TestPages(t *testing.T) {
+		vanitytest.Golden(t, "testdata/golden",
+			"-json", "testdata/packages.json", "-template", "page.html")
+	}
+
+The files are generated from fixture data, such as the packages listed
+by -json, by running the vanity command with the options given and -o
+a temporary directory. The command is found in the PATH, unless named
+by the environment variable VANITY.
+
+Running the tests with -vanitytest.update replaces the golden copies,
+and removes any no longer generated, so the directory must hold
+nothing else:
+
+	go test -run TestPages -vanitytest.update
+*/
+package vanitytest // import "whitehouse.id.au/vanity/vanitytest"
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("vanitytest.update", false, "replace the golden copies of the files vanity generates")
+
+// command returns the vanity command to run.
+func command() string {
+	if name := os.Getenv("VANITY"); name != "" {
+		return name
+	}
+	return "vanity"
+}
+
+// Generate runs vanity with the options args and returns the files it
+// writes, keyed by their slash-separated names.
+func Generate(t testing.TB, args ...string) map[string][]byte {
+	t.Helper()
+	dir := t.TempDir()
+	cmd := exec.Command(command(), append([]string{"-o", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("vanity %s: %v\n%s", strings.Join(args, " "), err, stderr.Bytes())
+	}
+	files, err := readFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// Golden checks that the files vanity generates with the options args
+// are those in the directory golden, reporting each that differs, or
+// with -vanitytest.update replaces them.
+func Golden(t testing.TB, golden string, args ...string) {
+	t.Helper()
+	got := Generate(t, args...)
+	want, err := readFiles(golden)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := replace(golden, got, want); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	names := make([]string, 0, len(got)+len(want))
+	for name := range got {
+		names = append(names, name)
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changed bool
+	for _, name := range names {
+		g, ok := got[name]
+		w, wantOK := want[name]
+		switch {
+		case !wantOK:
+			t.Errorf("%s: not in golden files", name)
+		case !ok:
+			t.Errorf("%s: no longer generated", name)
+		case !bytes.Equal(g, w):
+			t.Errorf("%s: differs from golden file\n%s", name, firstDiff(g, w))
+		default:
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		t.Logf("run with -vanitytest.update to accept the changes to %s", golden)
+	}
+}
+
+// replace writes the files got to the directory golden, removing those
+// in want no longer generated.
+func replace(golden string, got, want map[string][]byte) error {
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			if err := os.Remove(filepath.Join(golden, filepath.FromSlash(name))); err != nil {
+				return err
+			}
+		}
+	}
+	for name, b := range got {
+		name = filepath.Join(golden, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, b, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFiles returns the files in dir, keyed by their slash-separated
+// names relative to it.
+func readFiles(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	return files, err
+}
+
+// firstDiff describes the first line at which got differs from want.
+func firstDiff(got, want []byte) string {
+	g := strings.Split(string(got), "\n")
+	w := strings.Split(string(want), "\n")
+	for i := 0; ; i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl || i >= len(g) || i >= len(w) {
+			return fmt.Sprintf("line %d:\n\tgot:  %q\n\twant: %q", i+1, gl, wl)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package vanitytest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the test binary as a stand-in for vanity when
+// VANITYTEST_PAGE is set, writing that page for the import path given
+// after -o.
+func TestMain(m *testing.M) {
+	if page, ok := os.LookupEnv("VANITYTEST_PAGE"); ok {
+		dir, importPath := os.Args[2], os.Args[3]
+		name := filepath.Join(dir, filepath.FromSlash(importPath), "index.html")
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(name, []byte(page), 0666); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// recorder records the errors reported to it.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Logf(format string, args ...any) {}
+
+func TestGolden(t *testing.T) {
+	t.Setenv("VANITY", os.Args[0])
+	golden := t.TempDir()
+
+	t.Setenv("VANITYTEST_PAGE", "<p>foo</p>\n")
+	*update = true
+	Golden(t, golden, "vanity.example.com/foo")
+	*update = false
+	Golden(t, golden, "vanity.example.com/foo")
+
+	t.Setenv("VANITYTEST_PAGE", "<p>bar</p>\n")
+	r := &recorder{TB: t}
+	Golden(r, golden, "vanity.example.com/foo")
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "vanity.example.com/foo/index.html: differs from golden file") {
+		t.Errorf("changed page reported %q", r.errors)
+	}
+
+	r = &recorder{TB: t}
+	Golden(r, golden, "vanity.example.com/bar")
+	if len(r.errors) != 2 {
+		t.Errorf("moved page reported %q, want one missing and one new file", r.errors)
+	}
+
+	*update = true
+	Golden(t, golden, "vanity.example.com/bar")
+	*update = false
+	if _, err := os.Stat(filepath.Join(golden, "vanity.example.com", "foo", "index.html")); !os.IsNotExist(err) {
+		t.Errorf("updating kept the page no longer generated: %v", err)
+	}
+	Golden(t, golden, "vanity.example.com/bar")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/vcs"
+)
+
+// majorSuffix matches the major version suffix of a module path.
+var majorSuffix = regexp.MustCompile(`/v[0-9]+$`)
+
+// repositoryPath returns the import path of the repository holding the
+// module at modulePath in its directory rel: the module path without
+// the directory, or without a major version suffix that is not part of
+// the directory, as for a major version kept on a branch.
+func repositoryPath(modulePath, rel string) (string, bool) {
+	if rel == "" {
+		return majorSuffix.ReplaceAllString(modulePath, ""), true
+	}
+	if p, ok := strings.CutSuffix(modulePath, "/"+rel); ok {
+		return p, true
+	}
+	return strings.CutSuffix(majorSuffix.ReplaceAllString(modulePath, ""), "/"+rel)
+}
+
+// walkModule is a module found by walkInputs.
+type walkModule struct {
+	dir string
+	mod *goMod
+}
+
+// walkInputs describes each module found beneath dir, as given to -dir,
+// without the go command. Every repository checked out beneath dir is
+// found, and every go.mod file within it. Their import paths are read
+// from the go.mod files, and mapped to repositories by -replace or the
+// configuration, as packages named on the command line would be.
+func walkInputs(dir string) ([]InputPackage, error) {
+	roots := make(map[string]vcs.Type)
+	var modules []walkModule
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+
+		// Skip the directories the go command ignores.
+		base := info.Name()
+		if name != dir && (strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_") || base == "testdata" || base == "vendor") {
+			return filepath.SkipDir
+		}
+
+		if t, err := vcs.DetectVcsFromFS(name); err == nil {
+			roots[name] = t
+		}
+		mod, err := readGoMod(filepath.Join(name, "go.mod"))
+		if err != nil {
+			return err
+		}
+		if mod != nil {
+			if mod.Module == "" {
+				return fmt.Errorf("%s: no module directive", filepath.Join(name, "go.mod"))
+			}
+			modules = append(modules, walkModule{dir: name, mod: mod})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []InputPackage
+	rootPaths := make(map[string]string)
+	for _, m := range modules {
+		// The module belongs to the innermost repository holding it.
+		root := m.dir
+		for {
+			if _, ok := roots[root]; ok {
+				break
+			}
+			parent := filepath.Dir(root)
+			if parent == root || !strings.HasPrefix(parent, filepath.Clean(dir)) {
+				return nil, &PathError{ImportPath: m.mod.Module, Err: fmt.Errorf("%w: %s", ErrNoVCSRoot, m.dir)}
+			}
+			root = parent
+		}
+
+		rel, err := filepath.Rel(root, m.dir)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+
+		prefix, ok := repositoryPath(m.mod.Module, rel)
+		if !ok {
+			return nil, &PathError{ImportPath: m.mod.Module, Err: fmt.Errorf("module path does not end with its directory %s in %s", rel, root)}
+		}
+		rootPath, ok := rootPaths[root]
+		if !ok {
+			rootPath = prefix
+			rootPaths[root] = rootPath
+		}
+		if prefix != rootPath {
+			return nil, &PathError{ImportPath: m.mod.Module, Err: fmt.Errorf("module is in the repository for %s", rootPath)}
+		}
+
+		p := InputPackage{
+			ImportPath: m.mod.Module,
+			Root:       rootPath,
+			Repository: config.repository(rootPath),
+			Dir:        rel,
+			GoVersion:  m.mod.Go,
+		}
+		if t := roots[root]; t != vcs.Git {
+			p.VCS = string(t)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often the files watched by preview -watch are
+// checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// watcher generates files into a directory by running vanity with the
+// given arguments, and again whenever a file they name changes.
+type watcher struct {
+	dir  string
+	args []string
+
+	// names are the files and directories named by the arguments.
+	names []string
+}
+
+// newWatcher returns a watcher generating files into dir from args.
+func newWatcher(dir string, args []string) *watcher {
+	w := &watcher{dir: dir, args: args}
+
+	// The arguments are parsed only to find the files they name, so
+	// they are given to flags that record them rather than to those
+	// of this process.
+	fs := flag.NewFlagSet("vanity", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flag.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		fs.Var(&argValue{isBool: ok && b.IsBoolFlag()}, f.Name, f.Usage)
+	})
+	fs.Parse(args)
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "config", "template", "go-get-template", "error-template", "json", "assets", "favicon-dir", "dir", "f":
+			w.names = append(w.names, f.Value.(*argValue).values...)
+		}
+	})
+	return w
+}
+
+// argValue records the values given to a flag.
+type argValue struct {
+	values []string
+	isBool bool
+}
+
+func (v *argValue) String() string { return strings.Join(v.values, ",") }
+
+func (v *argValue) Set(s string) error {
+	v.values = append(v.values, s)
+	return nil
+}
+
+func (v *argValue) IsBoolFlag() bool { return v.isBool }
+
+// generate runs vanity to generate the files. It runs as a separate
+// process, so that a mistake in a template being edited is reported
+// without stopping the preview.
+func (w *watcher) generate() error {
+	cmd := exec.Command(os.Args[0], append([]string{"-o", w.dir}, w.args...)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("preview: generating %s: %v", w.dir, err)
+	}
+	return nil
+}
+
+// run generates the files again whenever those watched change, calling
+// changed after each successful run. It never returns.
+func (w *watcher) run(changed func()) {
+	last := w.modified()
+	for range time.Tick(watchInterval) {
+		mod := w.modified()
+		if mod.Equal(last) {
+			continue
+		}
+		last = mod
+		if err := w.generate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		changed()
+	}
+}
+
+// modified returns the latest modification time of the files watched,
+// including those beneath watched directories.
+func (w *watcher) modified() time.Time {
+	var latest time.Time
+	for _, name := range w.names {
+		if name == "-" {
+			continue
+		}
+		filepath.Walk(name, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+			return nil
+		})
+	}
+	return latest
+}